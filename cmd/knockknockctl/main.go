@@ -0,0 +1,308 @@
+// Command knockknockctl inspects and controls a running knockknock supervisor
+// over its IPC socket.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/zeitlos/knockknock/config"
+	"github.com/zeitlos/knockknock/ipc"
+)
+
+const usage = `Usage: knockknockctl [flags] <command> [args]
+
+Commands:
+  status            show the supervisor and child state
+  versions          list versions available in the registry
+  update <version>  update to the given version
+  rollback [version]
+                    roll back to the previous or the given installed version
+  restart [reason]  drain and restart the child
+  import <path>     install the version in an OCI layout directory or tar
+  history           list previously installed versions
+  jobs              list recent update and rollback jobs
+  logs              show recent supervisor logs and captured child output
+  crashes [id]      list crash reports or show a single report
+
+Flags:
+`
+
+type options struct {
+	app     string
+	socket  string
+	json    bool
+	timeout time.Duration
+	lines   int
+	source  string
+}
+
+// register adds the flags to fs. Current values become the defaults so that
+// flags can be given both before and after the command.
+func (o *options) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.app, "app", o.app, "app name used to discover the supervisor socket")
+	fs.StringVar(&o.socket, "socket", o.socket, "path of the supervisor socket, '@name' for abstract sockets")
+	fs.BoolVar(&o.json, "json", o.json, "print machine-readable JSON")
+	fs.DurationVar(&o.timeout, "timeout", o.timeout, "timeout for the request")
+	fs.IntVar(&o.lines, "n", o.lines, "number of log lines to show, 0 for all")
+	fs.StringVar(&o.source, "source", o.source, "log source to show: supervisor, child or empty for both")
+}
+
+func main() {
+	opts := &options{
+		timeout: 30 * time.Second,
+		lines:   50,
+	}
+
+	global := flag.NewFlagSet("knockknockctl", flag.ExitOnError)
+	global.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		global.PrintDefaults()
+	}
+	opts.register(global)
+	global.Parse(os.Args[1:])
+
+	if global.NArg() == 0 {
+		global.Usage()
+		os.Exit(2)
+	}
+
+	command := global.Arg(0)
+
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	fs.Usage = global.Usage
+	opts.register(fs)
+	fs.Parse(global.Args()[1:])
+
+	if err := run(opts, command, fs.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "knockknockctl: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(opts *options, command string, args []string) error {
+	socketPath, err := discoverSocket(opts.app, opts.socket)
+
+	if err != nil {
+		return err
+	}
+
+	client, err := ipc.NewClient(socketPath, ipc.WithTimeout(opts.timeout), ipc.WithRegistryTimeout(opts.timeout))
+
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", socketPath, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+
+	out := &printer{w: os.Stdout, json: opts.json}
+
+	switch command {
+	case "status":
+		status, err := client.Status(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		return out.status(status)
+	case "versions":
+		versions, err := listVersions(ctx, client)
+
+		if err != nil {
+			return err
+		}
+
+		status, err := client.Status(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		return out.versions(status, versions)
+	case "update":
+		if len(args) != 1 {
+			return errors.New("update requires exactly one version")
+		}
+
+		if err := client.Update(ctx, args[0]); err != nil {
+			return err
+		}
+
+		return out.message(fmt.Sprintf("update to %s initiated", args[0]))
+	case "rollback":
+		if len(args) > 1 {
+			return errors.New("rollback takes at most one version")
+		}
+
+		version := ""
+		if len(args) == 1 {
+			version = args[0]
+		}
+
+		if err := client.RollbackTo(ctx, version); err != nil {
+			return err
+		}
+
+		if version == "" {
+			return out.message("rollback to previous version initiated")
+		}
+
+		return out.message(fmt.Sprintf("rollback to %s initiated", version))
+	case "restart":
+		if err := client.Restart(ctx, strings.Join(args, " ")); err != nil {
+			return err
+		}
+
+		return out.message("restart initiated")
+	case "import":
+		if len(args) != 1 {
+			return errors.New("import requires exactly one path")
+		}
+
+		version, err := client.Import(ctx, args[0])
+
+		if err != nil {
+			return err
+		}
+
+		return out.message(fmt.Sprintf("import of %s initiated", version))
+	case "history":
+		history, err := client.History(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		return out.history(history)
+	case "jobs":
+		jobs, err := client.Jobs(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		return out.jobs(jobs)
+	case "logs":
+		logs, err := client.Logs(ctx, opts.source, opts.lines)
+
+		if err != nil {
+			return err
+		}
+
+		return out.logs(logs)
+	case "crashes":
+		if len(args) > 1 {
+			return errors.New("crashes takes at most one report id")
+		}
+
+		crashes, err := client.Crashes(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		if len(args) == 0 {
+			return out.crashes(crashes)
+		}
+
+		for _, crash := range crashes {
+			if crash.ID == args[0] {
+				return out.crash(crash)
+			}
+		}
+
+		return fmt.Errorf("crash report %q not found", args[0])
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+// discoverSocket finds the supervisor socket. An explicit path wins, then the
+// well-known locations for the app name. Without an app name, the runtime
+// directories are scanned and a single match is used.
+func discoverSocket(app, socket string) (string, error) {
+	if socket != "" {
+		return socket, nil
+	}
+
+	if app != "" {
+		for _, candidate := range config.SocketCandidates(app) {
+			if reachable(candidate) {
+				return candidate, nil
+			}
+		}
+
+		return "", fmt.Errorf("no supervisor found for app %q", app)
+	}
+
+	var found []string
+
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		matches, _ := filepath.Glob(filepath.Join(dir, "knockknock", "*.sock"))
+		found = append(found, matches...)
+	}
+
+	// /run/<app>/<app>.sock
+	matches, _ := filepath.Glob("/run/*/*.sock")
+
+	for _, match := range matches {
+		if strings.TrimSuffix(filepath.Base(match), ".sock") == filepath.Base(filepath.Dir(match)) {
+			found = append(found, match)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return "", errors.New("no supervisor socket found, use -app or -socket")
+	case 1:
+		return found[0], nil
+	default:
+		return "", fmt.Errorf("found several supervisor sockets (%s), use -app or -socket", strings.Join(found, ", "))
+	}
+}
+
+func reachable(socketPath string) bool {
+	if !config.IsAbstractSocket(socketPath) {
+		if _, err := os.Stat(socketPath); err != nil {
+			return false
+		}
+	}
+
+	conn, err := net.DialTimeout("unix", socketPath, time.Second)
+
+	if err != nil {
+		return false
+	}
+
+	conn.Close()
+
+	return true
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(v)
+}
+
+// listVersions returns the available versions, with their metadata if the
+// supervisor supports it.
+func listVersions(ctx context.Context, client *ipc.Client) (*ipc.VersionsResponse, error) {
+	if client.HasCapability(ipc.CapabilityMetadata) {
+		return client.Releases(ctx)
+	}
+
+	return client.ListVersions(ctx)
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/zeitlos/knockknock/ipc"
+)
+
+// printer renders command results either as tables or as JSON.
+type printer struct {
+	w    io.Writer
+	json bool
+}
+
+func (p *printer) message(msg string) error {
+	if p.json {
+		return writeJSON(p.w, map[string]string{"message": msg})
+	}
+
+	_, err := fmt.Fprintln(p.w, msg)
+	return err
+}
+
+func (p *printer) status(status *ipc.StatusResponse) error {
+	if p.json {
+		return writeJSON(p.w, status)
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "Version:\t%s\n", status.Version.String())
+	fmt.Fprintf(tw, "Supervisor PID:\t%d\n", status.PID)
+	fmt.Fprintf(tw, "Child PID:\t%s\n", pidOrDash(status.ChildPID))
+	fmt.Fprintf(tw, "Uptime:\t%s\n", time.Since(status.StartedAt).Round(time.Second))
+	fmt.Fprintf(tw, "Socket:\t%s\n", status.SocketPath)
+	fmt.Fprintf(tw, "Base path:\t%s\n", status.BasePath)
+	fmt.Fprintf(tw, "Crash count:\t%d\n", status.CrashCount)
+
+	if status.ActiveJob != nil {
+		fmt.Fprintf(tw, "Active job:\t%s %s %s\n", status.ActiveJob.ID, status.ActiveJob.Kind, status.ActiveJob.Version)
+	}
+
+	if c := status.LastCrash; c != nil {
+		fmt.Fprintf(tw, "Last crash:\t%s, version %s, %s (%s)\n", formatTime(c.Time), c.Version, c.Class, exitReason(c))
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if c := status.LastCrash; c != nil && c.Panic != nil {
+		fmt.Fprintf(p.w, "\n%s\n", c.Panic.Message)
+	}
+
+	return nil
+}
+
+func (p *printer) crashes(crashes []ipc.CrashEntry) error {
+	if p.json {
+		return writeJSON(p.w, ipc.CrashesResponse{Crashes: crashes})
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTIME\tVERSION\tCLASS\tEXIT\tUPTIME")
+
+	for _, c := range crashes {
+		uptime := time.Duration(c.UptimeSeconds * float64(time.Second)).Round(time.Second)
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", c.ID, formatTime(c.Time), c.Version, c.Class, exitReason(&c), uptime)
+	}
+
+	return tw.Flush()
+}
+
+func (p *printer) crash(crash ipc.CrashEntry) error {
+	if p.json {
+		return writeJSON(p.w, crash)
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "ID:\t%s\n", crash.ID)
+	fmt.Fprintf(tw, "Time:\t%s\n", formatTime(crash.Time))
+	fmt.Fprintf(tw, "Version:\t%s\n", crash.Version)
+	fmt.Fprintf(tw, "PID:\t%d\n", crash.PID)
+	fmt.Fprintf(tw, "Class:\t%s\n", crash.Class)
+	fmt.Fprintf(tw, "Exit:\t%s\n", exitReason(&crash))
+	fmt.Fprintf(tw, "Uptime:\t%s\n", time.Duration(crash.UptimeSeconds*float64(time.Second)).Round(time.Millisecond))
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if crash.Panic != nil {
+		fmt.Fprintf(p.w, "\n%s\n", crash.Panic.Message)
+
+		for _, g := range crash.Panic.Goroutines {
+			fmt.Fprintf(p.w, "\ngoroutine %d [%s]:\n", g.ID, g.State)
+
+			for _, f := range g.Frames {
+				fmt.Fprintf(p.w, "  %s\n      %s:%d\n", f.Function, f.File, f.Line)
+			}
+		}
+	} else if len(crash.Stderr) > 0 {
+		fmt.Fprintln(p.w, "\nLast stderr lines:")
+
+		for _, line := range crash.Stderr {
+			fmt.Fprintf(p.w, "  %s\n", line)
+		}
+	}
+
+	return nil
+}
+
+func exitReason(crash *ipc.CrashEntry) string {
+	if crash.Signal != "" {
+		return "signal " + crash.Signal
+	}
+
+	return fmt.Sprintf("exit code %d", crash.ExitCode)
+}
+
+func (p *printer) versions(status *ipc.StatusResponse, resp *ipc.VersionsResponse) error {
+	resp.Current = status.Version
+
+	if p.json {
+		return writeJSON(p.w, resp)
+	}
+
+	withMetadata := len(resp.Releases) == len(resp.Versions)
+
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+
+	if withMetadata {
+		fmt.Fprintln(tw, "VERSION\tCREATED\tSIZE\tNOTE")
+	} else {
+		fmt.Fprintln(tw, "VERSION\tNOTE")
+	}
+
+	for i, v := range resp.Versions {
+		var notes []string
+
+		switch {
+		case v.Equal(&status.Version):
+			notes = append(notes, "current")
+		case resp.Update != nil && v.Equal(resp.Update):
+			notes = append(notes, "update available")
+		}
+
+		if !withMetadata {
+			fmt.Fprintf(tw, "%s\t%s\n", v.String(), strings.Join(notes, ", "))
+			continue
+		}
+
+		release := resp.Releases[i]
+
+		if release.Critical {
+			notes = append(notes, "critical")
+		}
+
+		if release.MinSupervisorVersion != "" {
+			notes = append(notes, "requires "+release.MinSupervisorVersion)
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", v.String(), formatTime(release.Created), formatSize(release.Size), strings.Join(notes, ", "))
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if resp.Stale {
+		fmt.Fprintf(p.w, "\nThe update source is unreachable, showing versions as of %s\n", formatTime(resp.FetchedAt))
+	}
+
+	return nil
+}
+
+func (p *printer) history(history []ipc.HistoryEntry) error {
+	if p.json {
+		return writeJSON(p.w, ipc.HistoryResponse{History: history})
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tLAST INSTALLED")
+
+	for _, h := range history {
+		fmt.Fprintf(tw, "%s\t%s\n", h.Version.String(), formatTime(h.LastInstalled))
+	}
+
+	return tw.Flush()
+}
+
+func (p *printer) jobs(jobs []ipc.JobEntry) error {
+	if p.json {
+		return writeJSON(p.w, ipc.JobsResponse{Jobs: jobs})
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tKIND\tVERSION\tSTATE\tSTARTED\tERROR")
+
+	for _, j := range jobs {
+		version := j.Version
+		if version == "" {
+			version = "-"
+		}
+
+		state := j.State
+
+		if j.FinishedAt.IsZero() && j.BytesTotal > 0 {
+			state = fmt.Sprintf("%s (%d%%, %s)", j.State, j.BytesDone*100/j.BytesTotal, formatSize(j.BytesTotal))
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", j.ID, j.Kind, version, state, formatTime(j.StartedAt), j.Error)
+	}
+
+	return tw.Flush()
+}
+
+func (p *printer) logs(logs []ipc.LogEntry) error {
+	if p.json {
+		return writeJSON(p.w, ipc.LogsResponse{Logs: logs})
+	}
+
+	for _, l := range logs {
+		var attrs strings.Builder
+
+		for _, k := range slices.Sorted(maps.Keys(l.Attrs)) {
+			fmt.Fprintf(&attrs, " %s=%s", k, l.Attrs[k])
+		}
+
+		fmt.Fprintf(p.w, "%s %-10s %-5s %s%s\n", l.Time.Format(time.RFC3339), l.Source, l.Level, l.Message, attrs.String())
+	}
+
+	return nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+func formatSize(size int64) string {
+	switch {
+	case size == 0:
+		return "-"
+	case size < 1<<10:
+		return fmt.Sprintf("%d B", size)
+	case size < 1<<20:
+		return fmt.Sprintf("%.1f KiB", float64(size)/(1<<10))
+	default:
+		return fmt.Sprintf("%.1f MiB", float64(size)/(1<<20))
+	}
+}
+
+func pidOrDash(pid int) string {
+	if pid == 0 {
+		return "-"
+	}
+
+	return fmt.Sprint(pid)
+}
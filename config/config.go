@@ -1,12 +1,212 @@
 package config
 
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/zeitlos/knockknock/source"
+)
+
 type Config struct {
 	BinaryName      string
 	InstallationDir string
 	Repo            string
 	Version         string
 
+	// RuntimeDir is the directory holding the IPC socket. When empty it is
+	// derived from $RUNTIME_DIRECTORY, $XDG_RUNTIME_DIR or /run/<binary>.
+	RuntimeDir string
+	// SocketPath overrides the full socket path, including RuntimeDir.
+	SocketPath string
+	// AbstractSocket binds the IPC socket in the Linux abstract namespace
+	// as @knockknock/<binary> instead of on the filesystem.
+	AbstractSocket bool
+
+	// DrainTimeout bounds how long the child may take to acknowledge an
+	// upcoming restart before it is stopped anyway.
+	DrainTimeout time.Duration
+	// DrainPolicies overrides the drain behaviour per restart reason.
+	DrainPolicies map[RestartReason]DrainPolicy
+
+	// Metrics serves Prometheus metrics at /metrics on the IPC socket.
+	Metrics bool
+	// MetricsAddr additionally serves /metrics on a TCP address.
+	MetricsAddr string
+
+	// LogCapture captures the child's stdout and stderr into rotated files
+	// and an in-memory tail. Output is passed through unchanged when nil.
+	LogCapture *LogCaptureConfig
+	// MaxCrashReports is the number of crash reports kept in
+	// <installation dir>/<binary>/crashes. Zero disables crash reports.
+	MaxCrashReports int
+
+	// StartupTimeout is how long a started child has to say hello over IPC
+	// before it is killed and counted as crashed. Zero disables the check,
+	// which is needed for children that do not use knockknock.Run.
+	StartupTimeout time.Duration
+	// ManualReady leaves the hello to the app, which calls knockknock.Ready
+	// once it is initialised, instead of sending it before the app's main
+	// function runs.
+	ManualReady bool
+	// WatchdogTimeout enables the liveness watchdog. The child sends
+	// heartbeats over IPC, and if they stop for longer than the timeout it
+	// is sent SIGQUIT for a goroutine dump, then killed and restarted.
+	WatchdogTimeout time.Duration
+	// Liveness is checked by the child before each heartbeat. A failing or
+	// hanging check withholds the heartbeat.
+	Liveness func(ctx context.Context) error
+
+	// RestartPolicy decides whether the child is started again after it
+	// exited on its own. It defaults to RestartOnFailure.
+	RestartPolicy RestartPolicy
+	// RestartDelay is the pause before the child is started again.
+	RestartDelay time.Duration
+
+	// Platform selects the manifest from multi-arch image indexes, in the
+	// os/arch[/variant] notation, e.g. "linux/arm/v7". It defaults to the
+	// platform the binary was built for.
+	Platform string
+
+	// ImagePath is the path of the binary inside container images, used
+	// when a version is a regular image rather than an artifact. It
+	// defaults to /usr/local/bin/<binary name>.
+	ImagePath string
+
+	// Source replaces the OCI registry at Repo as the source of new
+	// versions, e.g. with a source.Directory or source.HTTPIndex.
+	Source source.UpdateSource
+
+	// VersionCacheTTL is how long a listing of the update source is reused.
+	// The last listing is kept on disk and served as stale while the source
+	// is unreachable, even with a zero TTL.
+	VersionCacheTTL time.Duration
+	// UpdateCheckInterval is how often the supervisor lists the update
+	// source in the background and publishes update-available for new
+	// versions. Zero disables background checks.
+	UpdateCheckInterval time.Duration
+
+	// ImportDir is watched for OCI image layouts, as directories or .tar
+	// archives, which are imported like updates. Processed layouts are moved
+	// to its imported/ and failed/ subdirectories.
+	ImportDir string
+
+	// PlainHTTP talks to the registry over HTTP instead of HTTPS.
+	PlainHTTP bool
+	// TLS configures certificates for the registry. Mirrors without TLS
+	// settings of their own use it too.
+	TLS *TLSConfig
+	// Proxy is the URL of the HTTP proxy for registry requests. The
+	// HTTP_PROXY, HTTPS_PROXY and NO_PROXY variables are used when empty.
+	Proxy string
+
+	// DownloadRateLimit caps registry downloads at this many bytes per
+	// second. Downloads are not limited when it is 0.
+	DownloadRateLimit int64
+	// DownloadCacheSize is how many bytes of downloaded blobs are kept in
+	// <base path>/cache/blobs, so interrupted downloads can be resumed and
+	// blobs are not downloaded twice. Least recently used blobs are removed
+	// first.
+	DownloadCacheSize int64
+
+	// Mirrors are repositories holding the same releases as Repo, tried
+	// when it is unreachable or, with MirrorLatency, when they are faster.
+	Mirrors []Mirror
+	// MirrorStrategy orders Repo and its mirrors. It defaults to
+	// MirrorOrdered.
+	MirrorStrategy MirrorStrategy
+
+	// Command starts the child process. It defaults to re-executing the
+	// running binary with the same arguments.
+	Command []string
+
+	// DevMode runs the app in-process against a fake update source instead
+	// of supervising it. It is also enabled by KNOCKKNOCK_DEV=1 or go run.
+	DevMode bool
+	// DevDir is the installation directory used in dev mode. A temporary
+	// directory is used when empty.
+	DevDir string
+	// DevVersions are the versions offered by the fake update source.
+	DevVersions []string
+
+	Auth *AuthConfig
+}
+
+type RestartReason string
+
+const (
+	RestartUpdate   RestartReason = "update"
+	RestartRollback RestartReason = "rollback"
+	RestartRestart  RestartReason = "restart"
+)
+
+type RestartPolicy string
+
+const (
+	// RestartAlways starts the child again after any exit.
+	RestartAlways RestartPolicy = "always"
+	// RestartOnFailure starts the child again after a non-zero exit or a
+	// signal, and stops the supervisor after a clean exit.
+	RestartOnFailure RestartPolicy = "on-failure"
+	// RestartNever stops the supervisor once the child exited, with the
+	// child's exit code.
+	RestartNever RestartPolicy = "never"
+)
+
+type MirrorStrategy string
+
+const (
+	// MirrorOrdered tries Repo first, then the mirrors in the order given.
+	MirrorOrdered MirrorStrategy = "ordered"
+	// MirrorLatency tries the repository with the lowest measured round-trip
+	// time first.
+	MirrorLatency MirrorStrategy = "latency"
+)
+
+type Mirror struct {
+	// Repo is the mirror's repository, e.g. "mirror.example.com/myorg/myapp".
+	Repo string
+	// Auth is used instead of the Docker credential store when set.
 	Auth *AuthConfig
+	// TLS configures certificates for the mirror. Config.TLS is used when
+	// nil.
+	TLS *TLSConfig
+	// PlainHTTP talks to the mirror over HTTP instead of HTTPS.
+	PlainHTTP bool
+}
+
+type TLSConfig struct {
+	// CAFile is a PEM bundle of CAs trusted in addition to the system's.
+	CAFile string
+	// CertFile and KeyFile are a PEM client certificate and key for mTLS.
+	CertFile string
+	KeyFile  string
+	// InsecureSkipVerify disables certificate verification. Only use it in
+	// lab environments.
+	InsecureSkipVerify bool
+}
+
+type DrainPolicy struct {
+	// Skip stops the child without asking it to prepare first.
+	Skip bool
+	// Timeout overrides DrainTimeout for this reason when non-zero.
+	Timeout time.Duration
+}
+
+type LogCaptureConfig struct {
+	// Dir holds the log files, <installation dir>/<binary>/logs by default.
+	Dir string
+	// MaxSize is the size in bytes at which the log file is rotated, 10 MiB
+	// by default.
+	MaxSize int64
+	// MaxFiles is the number of rotated files kept next to the current one,
+	// 5 by default.
+	MaxFiles int
+	// TailLines is the number of recent lines kept in memory, 200 by
+	// default.
+	TailLines int
 }
 
 type AuthConfig struct {
@@ -17,8 +217,16 @@ type AuthConfig struct {
 
 func New(binaryName string) *Config {
 	return &Config{
-		BinaryName:      binaryName,
-		InstallationDir: "/opt",
+		BinaryName:          binaryName,
+		InstallationDir:     "/opt",
+		DrainTimeout:        10 * time.Second,
+		MaxCrashReports:     20,
+		RestartPolicy:       RestartOnFailure,
+		RestartDelay:        time.Second,
+		VersionCacheTTL:     time.Minute,
+		UpdateCheckInterval: 15 * time.Minute,
+		MirrorStrategy:      MirrorOrdered,
+		DownloadCacheSize:   512 << 20,
 	}
 }
 
@@ -27,6 +235,38 @@ func (c *Config) WithRepo(repo string) *Config {
 	return c
 }
 
+func (c *Config) WithSource(source source.UpdateSource) *Config {
+	c.Source = source
+	return c
+}
+
+func (c *Config) WithVersionCacheTTL(ttl time.Duration) *Config {
+	c.VersionCacheTTL = ttl
+	return c
+}
+
+func (c *Config) WithUpdateCheckInterval(interval time.Duration) *Config {
+	c.UpdateCheckInterval = interval
+	return c
+}
+
+func (c *Config) WithImportDir(dir string) *Config {
+	c.ImportDir = dir
+	return c
+}
+
+// WithMirror adds a mirror of Repo. Mirrors are tried in the order they were
+// added.
+func (c *Config) WithMirror(mirror Mirror) *Config {
+	c.Mirrors = append(c.Mirrors, mirror)
+	return c
+}
+
+func (c *Config) WithMirrorStrategy(strategy MirrorStrategy) *Config {
+	c.MirrorStrategy = strategy
+	return c
+}
+
 func (c *Config) WithVersion(version string) *Config {
 	c.Version = version
 	return c
@@ -41,3 +281,250 @@ func (c *Config) WithInstallationDir(dir string) *Config {
 	c.InstallationDir = dir
 	return c
 }
+
+func (c *Config) WithDrainTimeout(timeout time.Duration) *Config {
+	c.DrainTimeout = timeout
+	return c
+}
+
+func (c *Config) WithDrainPolicy(reason RestartReason, policy DrainPolicy) *Config {
+	if c.DrainPolicies == nil {
+		c.DrainPolicies = map[RestartReason]DrainPolicy{}
+	}
+
+	c.DrainPolicies[reason] = policy
+	return c
+}
+
+// DrainPolicyFor returns the effective drain policy for a restart reason.
+func (c *Config) DrainPolicyFor(reason RestartReason) DrainPolicy {
+	policy := c.DrainPolicies[reason]
+
+	if policy.Timeout == 0 {
+		policy.Timeout = c.DrainTimeout
+	}
+
+	return policy
+}
+
+func (c *Config) WithMetrics() *Config {
+	c.Metrics = true
+	return c
+}
+
+// WithMetricsAddr enables metrics and also serves them on addr, e.g. ":9090".
+func (c *Config) WithMetricsAddr(addr string) *Config {
+	c.Metrics = true
+	c.MetricsAddr = addr
+	return c
+}
+
+// WithLogCapture enables capturing the child's output. Zero fields of
+// capture use their defaults.
+func (c *Config) WithLogCapture(capture *LogCaptureConfig) *Config {
+	if capture == nil {
+		capture = &LogCaptureConfig{}
+	}
+
+	c.LogCapture = capture
+	return c
+}
+
+func (c *Config) WithMaxCrashReports(n int) *Config {
+	c.MaxCrashReports = n
+	return c
+}
+
+func (c *Config) WithStartupTimeout(timeout time.Duration) *Config {
+	c.StartupTimeout = timeout
+	return c
+}
+
+func (c *Config) WithManualReady() *Config {
+	c.ManualReady = true
+	return c
+}
+
+func (c *Config) WithWatchdog(timeout time.Duration) *Config {
+	c.WatchdogTimeout = timeout
+	return c
+}
+
+func (c *Config) WithLiveness(check func(ctx context.Context) error) *Config {
+	c.Liveness = check
+	return c
+}
+
+func (c *Config) WithRestartPolicy(policy RestartPolicy) *Config {
+	c.RestartPolicy = policy
+	return c
+}
+
+func (c *Config) WithRestartDelay(delay time.Duration) *Config {
+	c.RestartDelay = delay
+	return c
+}
+
+func (c *Config) WithPlatform(platform string) *Config {
+	c.Platform = platform
+	return c
+}
+
+func (c *Config) WithImagePath(path string) *Config {
+	c.ImagePath = path
+	return c
+}
+
+func (c *Config) WithPlainHTTP() *Config {
+	c.PlainHTTP = true
+	return c
+}
+
+func (c *Config) WithTLS(tls *TLSConfig) *Config {
+	c.TLS = tls
+	return c
+}
+
+// WithCABundle trusts the CAs in the PEM file at path in addition to the
+// system's.
+func (c *Config) WithCABundle(path string) *Config {
+	c.tls().CAFile = path
+	return c
+}
+
+// WithClientCertificate authenticates to the registry with the PEM client
+// certificate and key for mTLS.
+func (c *Config) WithClientCertificate(certFile, keyFile string) *Config {
+	tls := c.tls()
+	tls.CertFile = certFile
+	tls.KeyFile = keyFile
+	return c
+}
+
+// WithInsecureSkipVerify disables certificate verification. Only use it in
+// lab environments.
+func (c *Config) WithInsecureSkipVerify() *Config {
+	c.tls().InsecureSkipVerify = true
+	return c
+}
+
+// WithDownloadRateLimit caps registry downloads at bytesPerSecond, e.g. to
+// keep updates from saturating a site's uplink.
+func (c *Config) WithDownloadRateLimit(bytesPerSecond int64) *Config {
+	c.DownloadRateLimit = bytesPerSecond
+	return c
+}
+
+func (c *Config) WithDownloadCacheSize(bytes int64) *Config {
+	c.DownloadCacheSize = bytes
+	return c
+}
+
+func (c *Config) WithProxy(url string) *Config {
+	c.Proxy = url
+	return c
+}
+
+func (c *Config) tls() *TLSConfig {
+	if c.TLS == nil {
+		c.TLS = &TLSConfig{}
+	}
+
+	return c.TLS
+}
+
+func (c *Config) WithCommand(command ...string) *Config {
+	c.Command = command
+	return c
+}
+
+func (c *Config) WithDevMode() *Config {
+	c.DevMode = true
+	return c
+}
+
+func (c *Config) WithDevDir(dir string) *Config {
+	c.DevDir = dir
+	return c
+}
+
+func (c *Config) WithDevVersions(versions ...string) *Config {
+	c.DevVersions = versions
+	return c
+}
+
+func (c *Config) WithRuntimeDir(dir string) *Config {
+	c.RuntimeDir = dir
+	return c
+}
+
+func (c *Config) WithSocketPath(path string) *Config {
+	c.SocketPath = path
+	return c
+}
+
+func (c *Config) WithAbstractSocket() *Config {
+	c.AbstractSocket = true
+	return c
+}
+
+// ResolveSocketPath returns the address the supervisor listens on. Paths
+// starting with '@' denote Linux abstract-namespace sockets.
+func (c *Config) ResolveSocketPath() string {
+	if c.SocketPath != "" {
+		return c.SocketPath
+	}
+
+	if c.AbstractSocket {
+		return AbstractSocketName(c.BinaryName)
+	}
+
+	return filepath.Join(c.ResolveRuntimeDir(), c.BinaryName+".sock")
+}
+
+// ResolveRuntimeDir returns the directory the IPC socket is created in.
+func (c *Config) ResolveRuntimeDir() string {
+	if c.RuntimeDir != "" {
+		return c.RuntimeDir
+	}
+
+	// systemd's RuntimeDirectory= may list several directories separated by ':'
+	if dir := os.Getenv("RUNTIME_DIRECTORY"); dir != "" {
+		return strings.Split(dir, ":")[0]
+	}
+
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "knockknock")
+	}
+
+	return filepath.Join("/run", c.BinaryName)
+}
+
+func AbstractSocketName(binaryName string) string {
+	return "@knockknock/" + binaryName
+}
+
+// IsAbstractSocket reports whether path refers to an abstract-namespace socket.
+func IsAbstractSocket(path string) bool {
+	return strings.HasPrefix(path, "@")
+}
+
+// SocketCandidates lists the addresses a supervisor for binaryName may be
+// listening on when no explicit path was configured, in resolution order.
+// Operator tooling uses it to find a running supervisor by app name.
+func SocketCandidates(binaryName string) []string {
+	var candidates []string
+
+	if dir := os.Getenv("RUNTIME_DIRECTORY"); dir != "" {
+		candidates = append(candidates, filepath.Join(strings.Split(dir, ":")[0], binaryName+".sock"))
+	}
+
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		candidates = append(candidates, filepath.Join(dir, "knockknock", binaryName+".sock"))
+	}
+
+	return append(candidates,
+		filepath.Join("/run", binaryName, binaryName+".sock"),
+		AbstractSocketName(binaryName),
+	)
+}
@@ -0,0 +1,71 @@
+package knockknock
+
+import (
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/zeitlos/knockknock/config"
+	"github.com/zeitlos/knockknock/ipc"
+	"github.com/zeitlos/knockknock/supervisor"
+)
+
+const devEnv = "KNOCKKNOCK_DEV"
+
+// isDevMode reports whether the app should run without a real supervisor.
+// KNOCKKNOCK_DEV overrides both the config and the go run detection.
+func isDevMode(config *config.Config) bool {
+	if v, ok := os.LookupEnv(devEnv); ok {
+		enabled, err := strconv.ParseBool(v)
+
+		if err != nil {
+			slog.Warn("ignoring invalid value", "env", devEnv, "value", v)
+		} else {
+			return enabled
+		}
+	}
+
+	if config.DevMode {
+		return true
+	}
+
+	// go run builds into a temporary go-build directory
+	exe, err := os.Executable()
+
+	return err == nil && strings.Contains(exe, string(os.PathSeparator)+"go-build")
+}
+
+// runDev runs userMain in-process, backed by a supervisor serving a fake
+// update source, so the app's update UI works without a registry.
+func runDev(config *config.Config, userMain func()) {
+	config.DevMode = true
+
+	sv, err := supervisor.New(config)
+
+	if err != nil {
+		slog.Error("failed to initalize dev supervisor", "error", err)
+		os.Exit(1)
+	}
+
+	server, err := ipc.NewIPCServer(sv)
+
+	if err != nil {
+		slog.Error("failed to initalize ipc server", "error", err)
+		os.Exit(1)
+	}
+
+	server.Serve()
+	defer server.Close()
+
+	slog.Info("running in dev mode", "pid", os.Getpid(), "socket", sv.SocketPath(), "version", config.Version)
+
+	ipcClient, err = ipc.NewClient(sv.SocketPath())
+
+	if err != nil {
+		slog.Error("failed to initalize ipc client", "error", err)
+		os.Exit(1)
+	}
+
+	userMain()
+}
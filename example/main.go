@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"html"
 	"log"
 	"log/slog"
 	"net/http"
@@ -13,6 +14,7 @@ import (
 
 	"github.com/zeitlos/knockknock"
 	"github.com/zeitlos/knockknock/config"
+	"github.com/zeitlos/knockknock/ipc"
 )
 
 // Will be overwritten in production builds
@@ -53,10 +55,11 @@ func run() {
 }
 
 func handleHome(w http.ResponseWriter, r *http.Request) {
-	update, versions, err := knockknock.Client().CheckForUpdate(r.Context())
+	releases, err := knockknock.Client().Releases(r.Context())
 
 	if err != nil {
 		slog.Error("failed to check for update from knockknock", "error", err)
+		releases = &ipc.VersionsResponse{}
 	}
 
 	history, err := knockknock.Client().History(r.Context())
@@ -66,14 +69,17 @@ func handleHome(w http.ResponseWriter, r *http.Request) {
 	}
 
 	versionOptions := ""
-	for _, v := range versions {
+	for _, release := range releases.Releases {
 		selected := ""
-		current := ""
-		if v.String() == Version {
+		label := ""
+		if release.Version == Version {
 			selected = "selected"
-			current = " (current)"
+			label = " (current)"
 		}
-		versionOptions += fmt.Sprintf(`<option value="%s" %s>%s%s</option>`, v, selected, v, current)
+		if release.Critical {
+			label += " (critical)"
+		}
+		versionOptions += fmt.Sprintf(`<option value="%s" title="%s" %s>%s%s</option>`, release.Version, html.EscapeString(release.Notes), selected, release.Version, label)
 	}
 
 	historyHTML := ""
@@ -83,7 +89,7 @@ func handleHome(w http.ResponseWriter, r *http.Request) {
 
 	newVersionClass := ""
 	newVersionStyle := "display: none;"
-	if update != nil {
+	if releases.Update != nil {
 		newVersionClass = "new-version-available"
 		newVersionStyle = "display: inline-block;"
 	}
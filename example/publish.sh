@@ -5,12 +5,13 @@ set -e
 # Check if version parameter is provided
 if [ -z "$1" ]; then
     echo "Error: Version parameter is required"
-    echo "Usage: $0 <version>"
-    echo "Example: $0 2.0.0"
+    echo "Usage: $0 <version> [release notes]"
+    echo "Example: $0 2.0.0 \"Adds a dark mode\""
     exit 1
 fi
 
 VERSION="$1"
+NOTES="$2"
 BINARY_NAME="testapp"
 REGISTRY="ghcr.io/zeitlos/knockknock"
 IMAGE_REF="${REGISTRY}/${BINARY_NAME}:${VERSION}"
@@ -25,8 +26,9 @@ echo ""
 echo "Publishing ${BINARY_NAME} to ${IMAGE_REF}"
 echo ""
 
-# Push the binary using ORAS
+# Push the binary using ORAS, with the release notes shown in the dashboard
 oras push "${IMAGE_REF}" \
+    --annotation "io.knockknock.notes=${NOTES}" \
     "${BINARY_NAME}:application/vnd.unknown.layer.v1+binary"
 
 rm $BINARY_NAME
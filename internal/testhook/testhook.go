@@ -0,0 +1,34 @@
+// Package testhook lets knockknocktest replace process-level side effects
+// of the supervisor without adding them to the public configuration.
+package testhook
+
+import (
+	"sync"
+
+	"github.com/zeitlos/knockknock/config"
+)
+
+var restartFuncs sync.Map
+
+// SetRestartFunc makes supervisors created from cfg call fn with the
+// activated version instead of terminating the process after an update or
+// rollback. A nil fn removes it.
+func SetRestartFunc(cfg *config.Config, fn func(version string) error) {
+	if fn == nil {
+		restartFuncs.Delete(cfg)
+		return
+	}
+
+	restartFuncs.Store(cfg, fn)
+}
+
+// RestartFunc returns the function set for cfg, or nil.
+func RestartFunc(cfg *config.Config) func(version string) error {
+	fn, ok := restartFuncs.Load(cfg)
+
+	if !ok {
+		return nil
+	}
+
+	return fn.(func(version string) error)
+}
@@ -4,40 +4,147 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Masterminds/semver/v3"
 )
 
+const (
+	defaultTimeout         = 5 * time.Second
+	defaultRegistryTimeout = time.Minute
+	defaultRetries         = 5
+	defaultBackoff         = 200 * time.Millisecond
+	maxBackoff             = 2 * time.Second
+)
+
+// registryEndpoints need a round-trip to the registry, or read an imported
+// layout from possibly slow media, and get the longer registry timeout.
+var registryEndpoints = map[string]bool{
+	"/versions": true,
+	"/import":   true,
+}
+
 type Client struct {
-	socketPath string
-	httpClient *http.Client
-}
-
-func NewClient(socketPath string) (*Client, error) {
-	httpClient := &http.Client{
-		Timeout: 2 * time.Second,
-		Transport: &http.Transport{
-			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
-				var d net.Dialer
-				return d.DialContext(ctx, "unix", socketPath)
-			},
+	socketPath   string
+	transport    *http.Transport
+	httpClient   *http.Client
+	streamClient *http.Client
+
+	timeout         time.Duration
+	registryTimeout time.Duration
+	retries         int
+	backoff         time.Duration
+
+	// prefix is prepended to every endpoint, empty for legacy supervisors
+	prefix       string
+	capabilities []string
+}
+
+type ClientOption func(*Client)
+
+// WithTimeout sets the timeout applied to each call unless the caller's
+// context expires earlier.
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// WithRegistryTimeout sets the timeout for calls that make the supervisor
+// contact the registry, such as listing versions.
+func WithRegistryTimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) {
+		c.registryTimeout = timeout
+	}
+}
+
+// WithRetries sets how often idempotent calls are attempted while the
+// supervisor is unavailable, and the initial backoff between attempts.
+func WithRetries(attempts int, backoff time.Duration) ClientOption {
+	return func(c *Client) {
+		c.retries = attempts
+		c.backoff = backoff
+	}
+}
+
+// NewClient connects to the supervisor at socketPath and negotiates the
+// protocol version. Supervisors without a /capabilities endpoint are spoken
+// to using the unversioned legacy endpoints.
+func NewClient(socketPath string, opts ...ClientOption) (*Client, error) {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socketPath)
 		},
 	}
 
-	return &Client{
+	c := &Client{
 		socketPath: socketPath,
-		httpClient: httpClient,
-	}, nil
+		transport:  transport,
+		// Timeouts are applied per call through the request context
+		httpClient:   &http.Client{Transport: transport},
+		streamClient: &http.Client{Transport: transport},
+
+		timeout:         defaultTimeout,
+		registryTimeout: defaultRegistryTimeout,
+		retries:         defaultRetries,
+		backoff:         defaultBackoff,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if err := c.handshake(context.Background()); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *Client) handshake(ctx context.Context) error {
+	var caps CapabilitiesResponse
+
+	err := c.do(ctx, http.MethodGet, "/capabilities", nil, &caps)
+
+	if apiErr := (*Error)(nil); errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound {
+		slog.Warn("supervisor does not support protocol negotiation, using legacy endpoints")
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to negotiate protocol: %w", err)
+	}
+
+	if !slices.Contains(caps.ProtocolVersions, ProtocolVersion) {
+		return fmt.Errorf("supervisor speaks protocol versions %v, client requires %d", caps.ProtocolVersions, ProtocolVersion)
+	}
+
+	c.prefix = protocolPrefix
+	c.capabilities = caps.Capabilities
+
+	return nil
+}
+
+// HasCapability reports whether the supervisor advertised the capability.
+func (c *Client) HasCapability(capability string) bool {
+	return slices.Contains(c.capabilities, capability)
 }
 
 func (c *Client) Versions(ctx context.Context) ([]semver.Version, error) {
-	resp, err := c.versions()
+	resp, err := c.versions(ctx)
 
 	if err != nil {
 		return nil, err
@@ -47,7 +154,7 @@ func (c *Client) Versions(ctx context.Context) ([]semver.Version, error) {
 }
 
 func (c *Client) CheckForUpdate(ctx context.Context) (*semver.Version, []semver.Version, error) {
-	resp, err := c.versions()
+	resp, err := c.versions(ctx)
 
 	if err != nil {
 		return nil, nil, err
@@ -60,128 +167,351 @@ func (c *Client) CheckForUpdate(ctx context.Context) (*semver.Version, []semver.
 	return resp.Update, resp.Versions, nil
 }
 
+// ListVersions returns the full versions response, including whether it is
+// stale because the update source could not be reached.
+func (c *Client) ListVersions(ctx context.Context) (*VersionsResponse, error) {
+	return c.versions(ctx)
+}
+
+// Releases is CheckForUpdate with the metadata of every version, such as
+// release notes and whether it is critical, in VersionsResponse.Releases.
+func (c *Client) Releases(ctx context.Context) (*VersionsResponse, error) {
+	if !c.HasCapability(CapabilityMetadata) {
+		return nil, fmt.Errorf("supervisor does not support version metadata")
+	}
+
+	var data VersionsResponse
+
+	if err := c.do(ctx, http.MethodGet, "/versions?metadata=true", nil, &data); err != nil {
+		return nil, fmt.Errorf("failed to query versions: %w", err)
+	}
+
+	return &data, nil
+}
+
 func (c *Client) Update(ctx context.Context, version string) error {
-	reqBody := UpdateRequest{
-		Version: version,
+	var updateResp UpdateResponse
+
+	if err := c.do(ctx, http.MethodPost, "/update", UpdateRequest{Version: version}, &updateResp); err != nil {
+		return fmt.Errorf("failed to send update request: %w", err)
 	}
 
-	body, err := json.Marshal(reqBody)
+	if !updateResp.Success {
+		return fmt.Errorf("update failed: %s", updateResp.Message)
+	}
 
-	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
+	return nil
+}
+
+func (c *Client) Rollback(ctx context.Context) error {
+	return c.RollbackTo(ctx, "")
+}
+
+// RollbackTo rolls back to a specific installed version. An empty version
+// rolls back to the previous one.
+func (c *Client) RollbackTo(ctx context.Context, version string) error {
+	var reqBody any
+
+	if version != "" {
+		if !c.HasCapability(CapabilityRollbackTo) {
+			return fmt.Errorf("supervisor does not support rolling back to a specific version")
+		}
+
+		reqBody = RollbackRequest{Version: version}
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://unix/update", bytes.NewReader(body))
+	var rollbackResp RollbackResponse
 
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+	if err := c.do(ctx, http.MethodPost, "/rollback", reqBody, &rollbackResp); err != nil {
+		return fmt.Errorf("failed to send rollback request: %w", err)
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.httpClient.Do(req)
+	if !rollbackResp.Success {
+		return fmt.Errorf("rollback failed: %s", rollbackResp.Message)
+	}
 
-	if err != nil {
-		return fmt.Errorf("failed to send update request: %w", err)
+	return nil
+}
+
+// Hello registers the calling child as started. Supervisors with a startup
+// timeout kill children that do not say hello in time. The response tells
+// the child how often to send heartbeats.
+func (c *Client) Hello(ctx context.Context, version string) (*HelloResponse, error) {
+	if !c.HasCapability(CapabilityHello) {
+		return nil, fmt.Errorf("supervisor does not support hello")
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("update request failed with status %d: %s", resp.StatusCode, string(body))
+	var helloResp HelloResponse
+
+	req := HelloRequest{
+		PID:     os.Getpid(),
+		Version: version,
 	}
 
-	var updateResp UpdateResponse
+	if err := c.do(ctx, http.MethodPost, "/hello", req, &helloResp); err != nil {
+		return nil, fmt.Errorf("failed to send hello: %w", err)
+	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&updateResp); err != nil {
-		return fmt.Errorf("failed to decode response: %w", err)
+	if !helloResp.Accepted {
+		return nil, fmt.Errorf("supervisor is not waiting for a child")
 	}
 
-	if !updateResp.Success {
-		return fmt.Errorf("update failed: %s", updateResp.Message)
+	return &helloResp, nil
+}
+
+// Heartbeat tells the supervisor's watchdog that the child is alive.
+func (c *Client) Heartbeat(ctx context.Context) error {
+	var heartbeatResp HeartbeatResponse
+
+	if err := c.do(ctx, http.MethodPost, "/heartbeat", nil, &heartbeatResp); err != nil {
+		return fmt.Errorf("failed to send heartbeat: %w", err)
+	}
+
+	if !heartbeatResp.Acknowledged {
+		return fmt.Errorf("supervisor is not expecting heartbeats")
 	}
 
 	return nil
 }
 
-func (c *Client) Rollback(ctx context.Context) error {
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://unix/rollback", nil)
+// Restart asks the supervisor to restart the child. The child is drained
+// like before an update and then terminated, and the restart is not counted
+// as a crash. The call returns once the restart was initiated.
+func (c *Client) Restart(ctx context.Context, reason string) error {
+	if !c.HasCapability(CapabilityRestart) {
+		return fmt.Errorf("supervisor does not support restarting the child")
+	}
 
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+	var restartResp RestartResponse
+
+	if err := c.do(ctx, http.MethodPost, "/restart", RestartRequest{Reason: reason}, &restartResp); err != nil {
+		return fmt.Errorf("failed to send restart request: %w", err)
 	}
 
-	resp, err := c.httpClient.Do(req)
+	if !restartResp.Success {
+		return fmt.Errorf("restart failed: %s", restartResp.Message)
+	}
+
+	return nil
+}
+
+// Import installs the version in an OCI image layout, a directory or a tar
+// archive of one, and returns the imported version. The path must be
+// readable by the supervisor.
+func (c *Client) Import(ctx context.Context, path string) (string, error) {
+	if !c.HasCapability(CapabilityImport) {
+		return "", fmt.Errorf("supervisor does not support imports")
+	}
+
+	path, err := filepath.Abs(path)
 
 	if err != nil {
-		return fmt.Errorf("failed to send rollback request: %w", err)
+		return "", fmt.Errorf("failed to resolve import path: %w", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("rollback request failed with status %d: %s", resp.StatusCode, string(body))
+	var importResp ImportResponse
+
+	if err := c.do(ctx, http.MethodPost, "/import", ImportRequest{Path: path}, &importResp); err != nil {
+		return "", fmt.Errorf("failed to send import request: %w", err)
 	}
 
-	var rollbackResp RollbackResponse
+	if !importResp.Success {
+		return "", fmt.Errorf("import failed: %s", importResp.Message)
+	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&rollbackResp); err != nil {
-		return fmt.Errorf("failed to decode response: %w", err)
+	return importResp.Version, nil
+}
+
+// ReadyForRestart tells the supervisor that the child has finished draining
+// after a restart-imminent event and may be stopped now.
+func (c *Client) ReadyForRestart(ctx context.Context) error {
+	var readyResp ReadyForRestartResponse
+
+	if err := c.do(ctx, http.MethodPost, "/restart/ready", nil, &readyResp); err != nil {
+		return fmt.Errorf("failed to send ready request: %w", err)
 	}
 
-	if !rollbackResp.Success {
-		return fmt.Errorf("rollback failed: %s", rollbackResp.Message)
+	if !readyResp.Acknowledged {
+		return fmt.Errorf("no restart is pending")
 	}
 
 	return nil
 }
 
 func (c *Client) History(ctx context.Context) ([]HistoryEntry, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://unix/history", nil)
+	var historyResp HistoryResponse
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+	if err := c.do(ctx, http.MethodGet, "/history", nil, &historyResp); err != nil {
+		return nil, fmt.Errorf("failed to query history: %w", err)
 	}
 
-	resp, err := c.httpClient.Do(req)
+	return historyResp.History, nil
+}
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to query history: %w", err)
+func (c *Client) Status(ctx context.Context) (*StatusResponse, error) {
+	var status StatusResponse
+
+	if err := c.do(ctx, http.MethodGet, "/status", nil, &status); err != nil {
+		return nil, fmt.Errorf("failed to query status: %w", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("history request failed with status %d: %s", resp.StatusCode, string(body))
+	return &status, nil
+}
+
+func (c *Client) Jobs(ctx context.Context) ([]JobEntry, error) {
+	var jobsResp JobsResponse
+
+	if err := c.do(ctx, http.MethodGet, "/jobs", nil, &jobsResp); err != nil {
+		return nil, fmt.Errorf("failed to query jobs: %w", err)
 	}
 
-	var historyResp HistoryResponse
+	return jobsResp.Jobs, nil
+}
+
+// Logs returns up to lines of the most recent log entries. Source is
+// "supervisor", "child" for captured child output, or empty for both. Zero
+// lines returns everything that is buffered.
+func (c *Client) Logs(ctx context.Context, source string, lines int) ([]LogEntry, error) {
+	var logsResp LogsResponse
 
-	if err := json.NewDecoder(resp.Body).Decode(&historyResp); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	query := url.Values{}
+	query.Set("lines", strconv.Itoa(lines))
+
+	if source != "" {
+		query.Set("source", source)
 	}
 
-	return historyResp.History, nil
+	if err := c.do(ctx, http.MethodGet, "/logs?"+query.Encode(), nil, &logsResp); err != nil {
+		return nil, fmt.Errorf("failed to query logs: %w", err)
+	}
+
+	return logsResp.Logs, nil
+}
+
+// Crashes returns the persisted crash reports of the child, newest first.
+func (c *Client) Crashes(ctx context.Context) ([]CrashEntry, error) {
+	if !c.HasCapability(CapabilityCrashes) {
+		return nil, fmt.Errorf("supervisor does not support crash reports")
+	}
+
+	var crashesResp CrashesResponse
+
+	if err := c.do(ctx, http.MethodGet, "/crashes", nil, &crashesResp); err != nil {
+		return nil, fmt.Errorf("failed to query crashes: %w", err)
+	}
+
+	return crashesResp.Crashes, nil
+}
+
+func (c *Client) versions(ctx context.Context) (*VersionsResponse, error) {
+	var data VersionsResponse
+
+	if err := c.do(ctx, http.MethodGet, "/versions", nil, &data); err != nil {
+		return nil, fmt.Errorf("failed to query versions: %w", err)
+	}
+
+	return &data, nil
 }
 
-func (c *Client) versions() (*VersionsResponse, error) {
-	resp, err := c.httpClient.Get("http://unix/versions")
+// url returns the address of an endpoint for the negotiated protocol.
+func (c *Client) url(path string) string {
+	return "http://unix" + c.prefix + path
+}
+
+// do sends in as JSON body, if non-nil, and decodes the response into out.
+// Idempotent calls are retried with backoff while the supervisor is
+// unavailable. Failed requests are returned as *Error.
+func (c *Client) do(ctx context.Context, method, path string, in, out any) error {
+	timeout := c.timeout
+
+	if registryEndpoints[strings.SplitN(path, "?", 2)[0]] {
+		timeout = c.registryTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var data []byte
+
+	if in != nil {
+		var err error
+
+		if data, err = json.Marshal(in); err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+	}
+
+	attempts := 1
+
+	if method == http.MethodGet && c.retries > 1 {
+		attempts = c.retries
+	}
+
+	backoff := c.backoff
+
+	for attempt := 1; ; attempt++ {
+		err := c.roundTrip(ctx, method, path, data, out)
+
+		if err == nil || attempt >= attempts || !errors.Is(err, ErrSupervisorUnavailable) {
+			return err
+		}
+
+		slog.Debug("supervisor unavailable, retrying", "path", path, "attempt", attempt, "error", err)
+
+		// Drop connections to the old socket so the next attempt redials
+		c.transport.CloseIdleConnections()
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+func (c *Client) roundTrip(ctx context.Context, method, path string, data []byte, out any) error {
+	var body io.Reader
+
+	if data != nil {
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.url(path), body)
+
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if data != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to query supervisor: %w", err)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+
+		return fmt.Errorf("%w: %w", ErrSupervisorUnavailable, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("supervisor returned status %d", resp.StatusCode)
+		return decodeError(resp)
 	}
 
-	var data VersionsResponse
+	if out == nil {
+		return nil
+	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	return &data, nil
+	return nil
 }
 
 func parseVersions(versions []string) []semver.Version {
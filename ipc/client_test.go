@@ -0,0 +1,242 @@
+package ipc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// socketPath returns a path for a unix socket that is removed after the test.
+func socketPath(t *testing.T) string {
+	t.Helper()
+
+	// Socket paths are limited to about 100 bytes, too short for t.TempDir
+	dir, err := os.MkdirTemp("", "kk-ipc-")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	return filepath.Join(dir, "ipc.sock")
+}
+
+// serve answers requests on the unix socket at path until the returned
+// function is called or the test ends.
+func serve(t *testing.T, path string, handler http.Handler) func() {
+	t.Helper()
+
+	listener, err := net.Listen("unix", path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &http.Server{Handler: handler}
+
+	go server.Serve(listener)
+
+	stop := func() { server.Close() }
+	t.Cleanup(stop)
+
+	return stop
+}
+
+// supervisorMux returns a mux that negotiates the current protocol, like a
+// supervisor built from this package.
+func supervisorMux() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/capabilities", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(CapabilitiesResponse{ProtocolVersions: []int{ProtocolVersion}})
+	})
+
+	return mux
+}
+
+func TestClientLegacySupervisor(t *testing.T) {
+	path := socketPath(t)
+
+	var requested atomic.Value
+
+	// Supervisors before protocol versioning have no /capabilities and
+	// answer unknown paths with a plain text 404
+	mux := http.NewServeMux()
+	mux.HandleFunc("/versions", func(w http.ResponseWriter, r *http.Request) {
+		requested.Store(r.URL.Path)
+		w.Write([]byte(`{"current":"1.0.0","versions":["1.0.0","1.1.0"]}`))
+	})
+
+	serve(t, path, mux)
+
+	client, err := NewClient(path, WithRetries(1, 0))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := client.Versions(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(versions) != 2 {
+		t.Fatalf("expected 2 versions, got %v", versions)
+	}
+
+	if path := requested.Load(); path != "/versions" {
+		t.Fatalf("expected the unprefixed endpoint, got %v", path)
+	}
+
+	if client.HasCapability(CapabilityStatus) {
+		t.Fatal("expected a legacy supervisor to have no capabilities")
+	}
+}
+
+func TestClientProtocolMismatch(t *testing.T) {
+	path := socketPath(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/capabilities", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(CapabilitiesResponse{ProtocolVersions: []int{ProtocolVersion + 1}})
+	})
+
+	serve(t, path, mux)
+
+	if _, err := NewClient(path, WithRetries(1, 0)); err == nil {
+		t.Fatal("expected an unsupported protocol version to fail")
+	}
+}
+
+func TestClientRetriesOnlyGets(t *testing.T) {
+	path := socketPath(t)
+
+	var gets, posts atomic.Int32
+
+	mux := supervisorMux()
+	mux.HandleFunc("/v1/status", func(w http.ResponseWriter, r *http.Request) {
+		gets.Add(1)
+		writeError(w, http.StatusServiceUnavailable, CodeUnavailable, "restarting")
+	})
+	mux.HandleFunc("/v1/update", func(w http.ResponseWriter, r *http.Request) {
+		posts.Add(1)
+		writeError(w, http.StatusServiceUnavailable, CodeUnavailable, "restarting")
+	})
+
+	serve(t, path, mux)
+
+	client, err := NewClient(path, WithRetries(3, time.Millisecond))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Status(context.Background()); !errors.Is(err, ErrSupervisorUnavailable) {
+		t.Fatalf("expected the supervisor to be unavailable, got %v", err)
+	}
+
+	if n := gets.Load(); n != 3 {
+		t.Fatalf("expected 3 attempts for a GET, got %d", n)
+	}
+
+	// An update may have started before the supervisor went away
+	if err := client.Update(context.Background(), "1.1.0"); !errors.Is(err, ErrSupervisorUnavailable) {
+		t.Fatalf("expected the supervisor to be unavailable, got %v", err)
+	}
+
+	if n := posts.Load(); n != 1 {
+		t.Fatalf("expected a POST to be sent once, got %d", n)
+	}
+}
+
+func TestClientWaitsForSocket(t *testing.T) {
+	path := socketPath(t)
+
+	mux := supervisorMux()
+	mux.HandleFunc("/v1/history", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"history":[{"version":"1.0.0"}]}`))
+	})
+
+	stop := serve(t, path, mux)
+
+	client, err := NewClient(path, WithRetries(10, 20*time.Millisecond))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The supervisor restarts and recreates its socket
+	stop()
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected the socket to be gone, got %v", err)
+	}
+
+	restarted := make(chan func())
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		restarted <- serve(t, path, mux)
+	}()
+
+	history, err := client.History(context.Background())
+	stop = <-restarted
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(history) != 1 {
+		t.Fatalf("expected 1 history entry, got %v", history)
+	}
+
+	// Without retries the missing socket fails right away
+	stop()
+
+	client.retries = 1
+
+	if _, err := client.History(context.Background()); !errors.Is(err, ErrSupervisorUnavailable) {
+		t.Fatalf("expected the supervisor to be unavailable, got %v", err)
+	}
+}
+
+func TestClientEndpointTimeouts(t *testing.T) {
+	path := socketPath(t)
+
+	slow := func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(200 * time.Millisecond):
+			w.Write([]byte(`{}`))
+		}
+	}
+
+	mux := supervisorMux()
+	mux.HandleFunc("/v1/status", slow)
+	mux.HandleFunc("/v1/versions", slow)
+
+	serve(t, path, mux)
+
+	client, err := NewClient(path, WithTimeout(50*time.Millisecond), WithRegistryTimeout(5*time.Second))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Status(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the status call to time out, got %v", err)
+	}
+
+	// Listing versions may contact the registry and gets the longer timeout
+	if _, err := client.ListVersions(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
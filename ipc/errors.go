@@ -0,0 +1,115 @@
+package ipc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Error codes returned in the error envelope.
+const (
+	CodeBadRequest       = "bad_request"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeNotFound         = "not_found"
+	CodeBusy             = "busy"
+	CodeUnsupported      = "unsupported"
+	CodeUnavailable      = "unavailable"
+	CodeNoChild          = "no_child"
+	CodeInternal         = "internal"
+)
+
+var (
+	// ErrSupervisorUnavailable is returned when the supervisor cannot be
+	// reached, for example while it is restarting.
+	ErrSupervisorUnavailable = errors.New("supervisor unavailable")
+	// ErrBusy is returned when the supervisor is already running a job.
+	ErrBusy = errors.New("supervisor busy")
+)
+
+// ErrorResponse is the envelope every failed request is answered with.
+type ErrorResponse struct {
+	Error ErrorBody `json:"error"`
+}
+
+type ErrorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error is returned by the client when the supervisor answers with an error.
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("supervisor returned %s (status %d): %s", e.Code, e.Status, e.Message)
+}
+
+// Is lets errors.Is match an *Error against ErrBusy and
+// ErrSupervisorUnavailable.
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrBusy:
+		return e.Code == CodeBusy
+	case ErrSupervisorUnavailable:
+		return e.Code == CodeUnavailable
+	default:
+		return false
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Error: ErrorBody{
+			Code:    code,
+			Message: message,
+		},
+	})
+}
+
+// decodeError turns a failed response into an *Error. Supervisors predating
+// the envelope answer with plain text, which becomes the message.
+func decodeError(resp *http.Response) error {
+	body, _ := io.ReadAll(resp.Body)
+
+	var envelope ErrorResponse
+
+	if err := json.Unmarshal(body, &envelope); err == nil && envelope.Error.Code != "" {
+		return &Error{
+			Status:  resp.StatusCode,
+			Code:    envelope.Error.Code,
+			Message: envelope.Error.Message,
+		}
+	}
+
+	return &Error{
+		Status:  resp.StatusCode,
+		Code:    codeForStatus(resp.StatusCode),
+		Message: strings.TrimSpace(string(body)),
+	}
+}
+
+func codeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeBusy
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	default:
+		return CodeInternal
+	}
+}
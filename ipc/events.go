@@ -0,0 +1,180 @@
+package ipc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zeitlos/knockknock/supervisor"
+)
+
+const (
+	EventUpdateAvailable   = string(supervisor.EventUpdateAvailable)
+	EventDownloadProgress  = string(supervisor.EventDownloadProgress)
+	EventUpdateReady       = string(supervisor.EventUpdateReady)
+	EventRestartImminent   = string(supervisor.EventRestartImminent)
+	EventRollback          = string(supervisor.EventRollback)
+	EventCrashLoopDetected = string(supervisor.EventCrashLoopDetected)
+)
+
+type Event struct {
+	Type       string    `json:"type"`
+	Time       time.Time `json:"time"`
+	Version    string    `json:"version,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+	Message    string    `json:"message,omitempty"`
+	Deadline   time.Time `json:"deadline,omitzero"`
+	BytesDone  int64     `json:"bytes_done,omitempty"`
+	BytesTotal int64     `json:"bytes_total,omitempty"`
+}
+
+const keepAliveInterval = 15 * time.Second
+
+// handleEvents streams supervisor events as server-sent events.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+
+	if !ok {
+		writeError(w, http.StatusInternalServerError, CodeUnsupported, "Streaming not supported")
+		return
+	}
+
+	events, unsubscribe := s.supervisor.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+
+			data, err := json.Marshal(newEvent(e))
+
+			if err != nil {
+				slog.Error("failed to encode event", "error", err)
+				continue
+			}
+
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+			flusher.Flush()
+		}
+	}
+}
+
+func newEvent(e supervisor.Event) Event {
+	return Event{
+		Type:       string(e.Type),
+		Time:       e.Time,
+		Version:    e.Version,
+		Reason:     e.Reason,
+		Message:    e.Message,
+		Deadline:   e.Deadline,
+		BytesDone:  e.BytesDone,
+		BytesTotal: e.BytesTotal,
+	}
+}
+
+// Subscribe streams supervisor events until ctx is cancelled. Dropped
+// connections are re-established, so events emitted while disconnected are
+// lost. The channel is closed when ctx is done.
+func (c *Client) Subscribe(ctx context.Context) <-chan Event {
+	ch := make(chan Event, 16)
+
+	if !c.HasCapability(CapabilityEvents) {
+		slog.Warn("supervisor does not support event streaming")
+		close(ch)
+
+		return ch
+	}
+
+	go func() {
+		defer close(ch)
+
+		for {
+			if err := c.stream(ctx, ch); err != nil && ctx.Err() == nil {
+				slog.Debug("event stream interrupted", "error", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+		}
+	}()
+
+	return ch
+}
+
+func (c *Client) stream(ctx context.Context, ch chan<- Event) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url("/events"), nil)
+
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := c.streamClient.Do(req)
+
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to events: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("events request failed with status %d", resp.StatusCode)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+
+	var data strings.Builder
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case line == "":
+			// A blank line terminates the event
+			if data.Len() == 0 {
+				continue
+			}
+
+			var event Event
+
+			if err := json.Unmarshal([]byte(data.String()), &event); err != nil {
+				slog.Warn("received invalid event from ipc server", "error", err)
+			} else {
+				select {
+				case ch <- event:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+
+			data.Reset()
+		case strings.HasPrefix(line, "data:"):
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+
+	return scanner.Err()
+}
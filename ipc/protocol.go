@@ -0,0 +1,53 @@
+package ipc
+
+// ProtocolVersion is the newest IPC protocol version spoken by this package.
+// Endpoints are served under /v<ProtocolVersion>/.
+const ProtocolVersion = 1
+
+const protocolPrefix = "/v1"
+
+// Capabilities advertised by the supervisor during the handshake. Clients
+// check them before using optional endpoints.
+const (
+	CapabilityEvents     = "events"
+	CapabilityDrain      = "drain"
+	CapabilityStatus     = "status"
+	CapabilityJobs       = "jobs"
+	CapabilityLogs       = "logs"
+	CapabilityRollbackTo = "rollback-to"
+	CapabilityMetrics    = "metrics"
+	CapabilityCrashes    = "crashes"
+	CapabilityRestart    = "restart"
+	CapabilityHello      = "hello"
+	CapabilityHeartbeat  = "heartbeat"
+	CapabilityImport     = "import"
+	CapabilityMetadata   = "version-metadata"
+)
+
+var capabilities = []string{
+	CapabilityEvents,
+	CapabilityDrain,
+	CapabilityStatus,
+	CapabilityJobs,
+	CapabilityLogs,
+	CapabilityRollbackTo,
+	CapabilityCrashes,
+	CapabilityRestart,
+	CapabilityHello,
+	CapabilityHeartbeat,
+	CapabilityImport,
+	CapabilityMetadata,
+}
+
+// legacyEndpoints are served without the version prefix as well, so clients
+// built before protocol versioning keep working. Clients ask for
+// /capabilities before they know the prefix, and scrapers expect /metrics
+// at a fixed path.
+var legacyEndpoints = map[string]bool{
+	"/capabilities": true,
+	"/versions":     true,
+	"/update":       true,
+	"/rollback":     true,
+	"/history":      true,
+	"/metrics":      true,
+}
@@ -1,29 +1,59 @@
 package ipc
 
 import (
-	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/Masterminds/semver/v3"
+	"github.com/zeitlos/knockknock/config"
+	"github.com/zeitlos/knockknock/source"
 	"github.com/zeitlos/knockknock/supervisor"
 )
 
 type Server struct {
-	listener   net.Listener
-	socketPath string
-	supervisor *supervisor.Supervisor
+	listener        net.Listener
+	metricsListener net.Listener
+	socketPath      string
+	supervisor      *supervisor.Supervisor
+}
+
+type CapabilitiesResponse struct {
+	ProtocolVersions  []int    `json:"protocol_versions"`
+	Capabilities      []string `json:"capabilities"`
+	SupervisorVersion string   `json:"supervisor_version"`
 }
 
 type VersionsResponse struct {
 	Update   *semver.Version  `json:"update"`
 	Current  semver.Version   `json:"current"`
 	Versions []semver.Version `json:"versions"`
+	// Releases describes each version, in the same order, when requested
+	// with ?metadata=true.
+	Releases []ReleaseEntry `json:"releases,omitempty"`
+	// Stale is set when the update source was unreachable and the versions
+	// are from the listing at FetchedAt.
+	Stale     bool      `json:"stale,omitempty"`
+	FetchedAt time.Time `json:"fetched_at,omitzero"`
+}
+
+type ReleaseEntry struct {
+	Version              string            `json:"version"`
+	Digest               string            `json:"digest,omitempty"`
+	Size                 int64             `json:"size,omitempty"`
+	Created              time.Time         `json:"created,omitzero"`
+	Notes                string            `json:"notes,omitempty"`
+	Critical             bool              `json:"critical,omitempty"`
+	MinSupervisorVersion string            `json:"min_supervisor_version,omitempty"`
+	Annotations          map[string]string `json:"annotations,omitempty"`
 }
 
 type UpdateRequest struct {
@@ -33,11 +63,133 @@ type UpdateRequest struct {
 type UpdateResponse struct {
 	Success bool   `json:"success"`
 	Message string `json:"message"`
+	JobID   string `json:"job_id,omitempty"`
+}
+
+type RollbackRequest struct {
+	Version string `json:"version,omitempty"`
 }
 
 type RollbackResponse struct {
 	Success bool   `json:"success"`
 	Message string `json:"message"`
+	JobID   string `json:"job_id,omitempty"`
+}
+
+type ImportRequest struct {
+	Path string `json:"path"`
+}
+
+type ImportResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	Version string `json:"version,omitempty"`
+	JobID   string `json:"job_id,omitempty"`
+}
+
+type RestartRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+type RestartResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	JobID   string `json:"job_id,omitempty"`
+}
+
+type HelloRequest struct {
+	PID     int    `json:"pid"`
+	Version string `json:"version"`
+}
+
+type HelloResponse struct {
+	Accepted bool `json:"accepted"`
+	// HeartbeatInterval is how often the child should call Heartbeat, zero
+	// when the watchdog is disabled.
+	HeartbeatInterval float64 `json:"heartbeat_interval_seconds,omitempty"`
+}
+
+type HeartbeatResponse struct {
+	Acknowledged bool `json:"acknowledged"`
+}
+
+type ReadyForRestartResponse struct {
+	Acknowledged bool `json:"acknowledged"`
+}
+
+type StatusResponse struct {
+	Version    semver.Version `json:"version"`
+	PID        int            `json:"pid"`
+	ChildPID   int            `json:"child_pid"`
+	ChildReady bool           `json:"child_ready"`
+	StartedAt  time.Time      `json:"started_at"`
+	SocketPath string         `json:"socket_path"`
+	BasePath   string         `json:"base_path"`
+	CrashCount int            `json:"crash_count"`
+	ActiveJob  *JobEntry      `json:"active_job,omitempty"`
+	LastCrash  *CrashEntry    `json:"last_crash,omitempty"`
+}
+
+type CrashesResponse struct {
+	Crashes []CrashEntry `json:"crashes"`
+}
+
+type CrashEntry struct {
+	ID            string      `json:"id"`
+	Time          time.Time   `json:"time"`
+	Version       string      `json:"version"`
+	PID           int         `json:"pid"`
+	ExitCode      int         `json:"exit_code"`
+	Signal        string      `json:"signal,omitempty"`
+	UptimeSeconds float64     `json:"uptime_seconds"`
+	Class         string      `json:"class"`
+	Stderr        []string    `json:"stderr,omitempty"`
+	Panic         *PanicEntry `json:"panic,omitempty"`
+}
+
+type PanicEntry struct {
+	Message    string           `json:"message"`
+	Goroutines []GoroutineEntry `json:"goroutines,omitempty"`
+}
+
+type GoroutineEntry struct {
+	ID     int          `json:"id"`
+	State  string       `json:"state"`
+	Frames []FrameEntry `json:"frames,omitempty"`
+}
+
+type FrameEntry struct {
+	Function string `json:"function"`
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+}
+
+type JobsResponse struct {
+	Jobs []JobEntry `json:"jobs"`
+}
+
+type JobEntry struct {
+	ID         string    `json:"id"`
+	Kind       string    `json:"kind"`
+	Version    string    `json:"version,omitempty"`
+	State      string    `json:"state"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at,omitzero"`
+	BytesDone  int64     `json:"bytes_done,omitempty"`
+	BytesTotal int64     `json:"bytes_total,omitempty"`
+}
+
+type LogsResponse struct {
+	Logs []LogEntry `json:"logs"`
+}
+
+type LogEntry struct {
+	Time    time.Time         `json:"time"`
+	Source  string            `json:"source"`
+	Level   string            `json:"level"`
+	Message string            `json:"message"`
+	Attrs   map[string]string `json:"attrs,omitempty"`
 }
 
 type HistoryResponse struct {
@@ -50,10 +202,16 @@ type HistoryEntry struct {
 }
 
 func NewIPCServer(sv *supervisor.Supervisor) (*Server, error) {
-	socketPath := supervisor.SocketPath()
+	socketPath := sv.SocketPath()
 
-	// Clean up old socket if exists
-	os.Remove(socketPath)
+	if !config.IsAbstractSocket(socketPath) {
+		if err := os.MkdirAll(filepath.Dir(socketPath), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create runtime directory: %w", err)
+		}
+
+		// Clean up old socket if exists
+		os.Remove(socketPath)
+	}
 
 	listener, err := net.Listen("unix", socketPath)
 
@@ -67,46 +225,142 @@ func NewIPCServer(sv *supervisor.Supervisor) (*Server, error) {
 		supervisor: sv,
 	}
 
+	if addr := sv.Config().MetricsAddr; addr != "" {
+		server.metricsListener, err = net.Listen("tcp", addr)
+
+		if err != nil {
+			listener.Close()
+			return nil, fmt.Errorf("failed to listen on metrics address: %w", err)
+		}
+	}
+
 	return &server, nil
 }
 
 func (s *Server) Serve() {
 	mux := http.NewServeMux()
 
-	mux.HandleFunc("/versions", s.handleVersions)
-	mux.HandleFunc("/update", s.handleUpdate)
-	mux.HandleFunc("/rollback", s.handleRollback)
-	mux.HandleFunc("/history", s.handleHistory)
+	mux.HandleFunc("/", s.handleNotFound)
+
+	s.handle(mux, "/capabilities", s.handleCapabilities)
+	s.handle(mux, "/versions", s.handleVersions)
+	s.handle(mux, "/update", s.handleUpdate)
+	s.handle(mux, "/rollback", s.handleRollback)
+	s.handle(mux, "/history", s.handleHistory)
+	s.handle(mux, "/status", s.handleStatus)
+	s.handle(mux, "/jobs", s.handleJobs)
+	s.handle(mux, "/logs", s.handleLogs)
+	s.handle(mux, "/crashes", s.handleCrashes)
+	s.handle(mux, "/events", s.handleEvents)
+	s.handle(mux, "/hello", s.handleHello)
+	s.handle(mux, "/heartbeat", s.handleHeartbeat)
+	s.handle(mux, "/restart", s.handleRestart)
+	s.handle(mux, "/import", s.handleImport)
+	s.handle(mux, "/restart/ready", s.handleReadyForRestart)
+
+	if s.supervisor.Config().Metrics {
+		s.handle(mux, "/metrics", s.handleMetrics)
+	}
 
 	go func() {
-		if err := http.Serve(s.listener, mux); err != nil {
+		if err := http.Serve(s.listener, mux); err != nil && !errors.Is(err, net.ErrClosed) {
 			slog.Error("IPC server error", "error", err)
 		}
 	}()
+
+	if s.metricsListener != nil {
+		metricsMux := http.NewServeMux()
+		metricsMux.HandleFunc("/metrics", s.handleMetrics)
+
+		go func() {
+			if err := http.Serve(s.metricsListener, metricsMux); err != nil && !errors.Is(err, net.ErrClosed) {
+				slog.Error("metrics server error", "error", err)
+			}
+		}()
+	}
+}
+
+// handle registers an endpoint under the current protocol prefix. Endpoints
+// that existed before versioning are also served unprefixed for older clients.
+func (s *Server) handle(mux *http.ServeMux, path string, handler http.HandlerFunc) {
+	mux.HandleFunc(protocolPrefix+path, handler)
+
+	if legacyEndpoints[path] {
+		mux.HandleFunc(path, handler)
+	}
 }
 
 func (s *Server) Close() error {
 	if s.listener != nil {
 		s.listener.Close()
 	}
-	os.Remove(s.socketPath)
+
+	if s.metricsListener != nil {
+		s.metricsListener.Close()
+	}
+
+	if !config.IsAbstractSocket(s.socketPath) {
+		os.Remove(s.socketPath)
+	}
+
 	return nil
 }
 
 func (s *Server) handleVersions(w http.ResponseWriter, r *http.Request) {
-	update, versions, err := s.supervisor.CheckForUpdate(r.Context())
+	withMetadata, _ := strconv.ParseBool(r.URL.Query().Get("metadata"))
+
+	if withMetadata {
+		s.handleReleases(w, r)
+		return
+	}
+
+	list, err := s.supervisor.ListVersions(r.Context())
 
 	if err != nil {
 		slog.Error("failed to fetch versions", "error", err)
 
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, CodeInternal, err.Error())
 		return
 	}
 
 	resp := VersionsResponse{
-		Update:   update,
-		Current:  *s.supervisor.CurrentVersion(),
-		Versions: versions,
+		Update:    list.Update,
+		Current:   *s.supervisor.CurrentVersion(),
+		Versions:  list.Versions,
+		Stale:     list.Stale,
+		FetchedAt: list.FetchedAt,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *Server) handleReleases(w http.ResponseWriter, r *http.Request) {
+	list, releases, err := s.supervisor.Releases(r.Context())
+
+	if err != nil {
+		slog.Error("failed to fetch versions", "error", err)
+
+		writeError(w, http.StatusInternalServerError, CodeInternal, err.Error())
+		return
+	}
+
+	resp := VersionsResponse{
+		Update:    list.Update,
+		Current:   *s.supervisor.CurrentVersion(),
+		Stale:     list.Stale,
+		FetchedAt: list.FetchedAt,
+	}
+
+	for _, release := range releases {
+		v, err := semver.NewVersion(release.Version)
+
+		if err != nil {
+			continue
+		}
+
+		resp.Versions = append(resp.Versions, *v)
+		resp.Releases = append(resp.Releases, newReleaseEntry(release))
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -115,34 +369,36 @@ func (s *Server) handleVersions(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) handleUpdate(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	var req UpdateRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, CodeBadRequest, "Invalid request body")
 		return
 	}
 
 	if req.Version == "" {
-		http.Error(w, "Version is required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, CodeBadRequest, "Version is required")
 		return
 	}
 
 	slog.Info("Updating to version", "version", req.Version)
 
 	// Start update in background - this will kill the process
-	go func() {
-		if err := s.supervisor.Update(context.Background(), req.Version); err != nil {
-			slog.Error("Update failed", "error", err, "version", req.Version)
-		}
-	}()
+	job, err := s.supervisor.StartUpdate(req.Version)
+
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
 
 	// Return success immediately before process is killed
 	response := UpdateResponse{
 		Success: true,
 		Message: fmt.Sprintf("Update to version %s initiated, process will restart", req.Version),
+		JobID:   job.ID,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -151,29 +407,162 @@ func (s *Server) handleUpdate(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) handleRollback(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
 		return
 	}
 
-	slog.Info("Initiating rollback")
+	// The body is optional, an empty request rolls back to the previous version
+	var req RollbackRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, CodeBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	slog.Info("Initiating rollback", "version", req.Version)
 
 	// Start rollback in background - this will kill the process
-	go func() {
-		if err := s.supervisor.Rollback(); err != nil {
-			slog.Error("Rollback failed", "error", err)
-		}
-	}()
+	job, err := s.supervisor.StartRollback(req.Version)
+
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
 
 	// Return success immediately before process is killed
 	response := RollbackResponse{
 		Success: true,
 		Message: "Rollback initiated, process will restart",
+		JobID:   job.ID,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) handleHello(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req HelloRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, CodeBadRequest, "Invalid request body")
+		return
+	}
+
+	response := HelloResponse{
+		Accepted: s.supervisor.Hello(req.PID, req.Version),
+	}
+
+	if response.Accepted {
+		response.HeartbeatInterval = s.supervisor.HeartbeatInterval().Seconds()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) handleHeartbeat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	response := HeartbeatResponse{
+		Acknowledged: s.supervisor.Heartbeat(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) handleRestart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req RestartRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, CodeBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	slog.Info("Initiating child restart", "reason", req.Reason)
+
+	// The requesting child may be the one being restarted, so respond
+	// before it is drained and terminated
+	job, err := s.supervisor.StartRestart(req.Reason)
+
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+
+	response := RestartResponse{
+		Success: true,
+		Message: "Restart initiated, child will restart",
+		JobID:   job.ID,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) handleImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req ImportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, CodeBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Path == "" {
+		writeError(w, http.StatusBadRequest, CodeBadRequest, "Path is required")
+		return
+	}
+
+	job, err := s.supervisor.StartImport(req.Path)
+
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+
+	response := ImportResponse{
+		Success: true,
+		Message: fmt.Sprintf("Import of version %s initiated, process will restart", job.Version),
+		Version: job.Version,
+		JobID:   job.ID,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+func (s *Server) handleReadyForRestart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	resp := ReadyForRestartResponse{
+		Acknowledged: s.supervisor.ReadyForRestart(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
 func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
 	history := s.supervisor.History()
 
@@ -191,3 +580,216 @@ func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	status := s.supervisor.Status()
+
+	resp := StatusResponse{
+		Version:    status.Version,
+		PID:        status.PID,
+		ChildPID:   status.ChildPID,
+		ChildReady: status.ChildReady,
+		StartedAt:  status.StartedAt,
+		SocketPath: status.SocketPath,
+		BasePath:   status.BasePath,
+		CrashCount: status.CrashCount,
+	}
+
+	if status.ActiveJob != nil {
+		job := newJobEntry(*status.ActiveJob)
+		resp.ActiveJob = &job
+	}
+
+	if status.LastCrash != nil {
+		crash := newCrashEntry(*status.LastCrash)
+		resp.LastCrash = &crash
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	jobs := s.supervisor.Jobs()
+
+	resp := JobsResponse{
+		Jobs: make([]JobEntry, len(jobs)),
+	}
+
+	for i, job := range jobs {
+		resp.Jobs[i] = newJobEntry(job)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *Server) handleCrashes(w http.ResponseWriter, r *http.Request) {
+	crashes, err := s.supervisor.Crashes()
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, err.Error())
+		return
+	}
+
+	resp := CrashesResponse{
+		Crashes: make([]CrashEntry, len(crashes)),
+	}
+
+	for i, crash := range crashes {
+		resp.Crashes[i] = newCrashEntry(crash)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func newCrashEntry(crash supervisor.CrashReport) CrashEntry {
+	entry := CrashEntry{
+		ID:            crash.ID,
+		Time:          crash.Time,
+		Version:       crash.Version,
+		PID:           crash.PID,
+		ExitCode:      crash.ExitCode,
+		Signal:        crash.Signal,
+		UptimeSeconds: crash.UptimeSeconds,
+		Class:         string(crash.Class),
+		Stderr:        crash.Stderr,
+	}
+
+	if p := crash.Panic; p != nil {
+		entry.Panic = &PanicEntry{Message: p.Message}
+
+		for _, g := range p.Goroutines {
+			goroutine := GoroutineEntry{ID: g.ID, State: g.State}
+
+			for _, f := range g.Frames {
+				goroutine.Frames = append(goroutine.Frames, FrameEntry{
+					Function: f.Function,
+					File:     f.File,
+					Line:     f.Line,
+				})
+			}
+
+			entry.Panic.Goroutines = append(entry.Panic.Goroutines, goroutine)
+		}
+	}
+
+	return entry
+}
+
+func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
+	lines := 0
+
+	if v := r.URL.Query().Get("lines"); v != "" {
+		n, err := strconv.Atoi(v)
+
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, CodeBadRequest, "Invalid lines parameter")
+			return
+		}
+
+		lines = n
+	}
+
+	source := r.URL.Query().Get("source")
+
+	if source != "" && source != supervisor.LogSourceSupervisor && source != supervisor.LogSourceChild {
+		writeError(w, http.StatusBadRequest, CodeBadRequest, "Invalid source parameter")
+		return
+	}
+
+	logs := s.supervisor.Logs(source, lines)
+
+	resp := LogsResponse{
+		Logs: make([]LogEntry, len(logs)),
+	}
+
+	for i, l := range logs {
+		resp.Logs[i] = LogEntry{
+			Time:    l.Time,
+			Source:  l.Source,
+			Level:   l.Level,
+			Message: l.Message,
+			Attrs:   l.Attrs,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *Server) handleCapabilities(w http.ResponseWriter, r *http.Request) {
+	caps := capabilities
+
+	if s.supervisor.Config().Metrics {
+		caps = append(slices.Clone(caps), CapabilityMetrics)
+	}
+
+	resp := CapabilitiesResponse{
+		ProtocolVersions:  []int{ProtocolVersion},
+		Capabilities:      caps,
+		SupervisorVersion: s.supervisor.CurrentVersion().String(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	if err := s.supervisor.WriteMetrics(w); err != nil {
+		slog.Error("failed to write metrics", "error", err)
+	}
+}
+
+func (s *Server) handleNotFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusNotFound, CodeNotFound, fmt.Sprintf("unknown endpoint %s", r.URL.Path))
+}
+
+func writeJobError(w http.ResponseWriter, err error) {
+	if errors.Is(err, supervisor.ErrBusy) {
+		writeError(w, http.StatusConflict, CodeBusy, err.Error())
+		return
+	}
+
+	if errors.Is(err, supervisor.ErrNoChild) {
+		writeError(w, http.StatusConflict, CodeNoChild, err.Error())
+		return
+	}
+
+	if errors.Is(err, supervisor.ErrInvalidImport) || errors.Is(err, supervisor.ErrInvalidVersion) {
+		writeError(w, http.StatusBadRequest, CodeBadRequest, err.Error())
+		return
+	}
+
+	writeError(w, http.StatusInternalServerError, CodeInternal, err.Error())
+}
+
+func newReleaseEntry(metadata source.Metadata) ReleaseEntry {
+	return ReleaseEntry{
+		Version:              metadata.Version,
+		Digest:               metadata.Digest.String(),
+		Size:                 metadata.Size,
+		Created:              metadata.Created,
+		Notes:                metadata.Notes,
+		Critical:             metadata.Critical,
+		MinSupervisorVersion: metadata.MinSupervisorVersion,
+		Annotations:          metadata.Annotations,
+	}
+}
+
+func newJobEntry(job supervisor.Job) JobEntry {
+	return JobEntry{
+		ID:         job.ID,
+		Kind:       string(job.Kind),
+		Version:    job.Version,
+		State:      string(job.State),
+		Error:      job.Error,
+		StartedAt:  job.StartedAt,
+		FinishedAt: job.FinishedAt,
+		BytesDone:  job.BytesDone,
+		BytesTotal: job.BytesTotal,
+	}
+}
@@ -0,0 +1,120 @@
+package knockknocktest
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// Installation is a temporary installation directory laid out like
+// /opt/<binary>: versions/<version>/<binary> plus the current symlink.
+type Installation struct {
+	// Dir is the installation directory, see config.WithInstallationDir.
+	Dir        string
+	BinaryName string
+}
+
+// NewInstallation creates an installation with binary installed and
+// activated as version.
+func NewInstallation(t testing.TB, binaryName, version string, binary []byte) *Installation {
+	t.Helper()
+
+	inst := &Installation{
+		Dir:        t.TempDir(),
+		BinaryName: binaryName,
+	}
+
+	inst.Install(t, version, binary)
+	inst.Activate(t, version)
+
+	return inst
+}
+
+// BasePath returns the directory holding versions and symlinks.
+func (i *Installation) BasePath() string {
+	return filepath.Join(i.Dir, i.BinaryName)
+}
+
+// Install places binary in the version's directory without activating it.
+func (i *Installation) Install(t testing.TB, version string, binary []byte) {
+	t.Helper()
+
+	dir := filepath.Join(i.BasePath(), "versions", version)
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("failed to create version directory: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, i.BinaryName), binary, 0755); err != nil {
+		t.Fatalf("failed to write binary: %v", err)
+	}
+}
+
+// Activate points the current symlink at an installed version.
+func (i *Installation) Activate(t testing.TB, version string) {
+	t.Helper()
+
+	link := filepath.Join(i.BasePath(), "current")
+	os.Remove(link)
+
+	if err := os.Symlink(filepath.Join(i.BasePath(), "versions", version), link); err != nil {
+		t.Fatalf("failed to create current symlink: %v", err)
+	}
+}
+
+// Current returns the version the current symlink points at.
+func (i *Installation) Current(t testing.TB) string {
+	t.Helper()
+
+	target, err := os.Readlink(filepath.Join(i.BasePath(), "current"))
+
+	if err != nil {
+		t.Fatalf("failed to read current symlink: %v", err)
+	}
+
+	return filepath.Base(target)
+}
+
+// Versions returns the installed versions in lexical order.
+func (i *Installation) Versions(t testing.TB) []string {
+	t.Helper()
+
+	entries, err := os.ReadDir(filepath.Join(i.BasePath(), "versions"))
+
+	if err != nil {
+		t.Fatalf("failed to read versions directory: %v", err)
+	}
+
+	var versions []string
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			versions = append(versions, entry.Name())
+		}
+	}
+
+	sort.Strings(versions)
+
+	return versions
+}
+
+// Executable returns the contents of the running test binary. It is a valid
+// ELF executable and passes the supervisor's binary verification.
+func Executable(t testing.TB) []byte {
+	t.Helper()
+
+	exe, err := os.Executable()
+
+	if err != nil {
+		t.Fatalf("failed to locate test executable: %v", err)
+	}
+
+	data, err := os.ReadFile(exe)
+
+	if err != nil {
+		t.Fatalf("failed to read test executable: %v", err)
+	}
+
+	return data
+}
@@ -0,0 +1,463 @@
+// Package knockknocktest provides helpers to test knockknock integrations
+// without network access: an in-memory OCI registry, a temporary
+// installation layout and an in-process supervisor.
+package knockknocktest
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// BinaryMediaType is the layer media type used for pushed binaries, matching
+// what `oras push` uses in the example publish script.
+const BinaryMediaType = "application/vnd.unknown.layer.v1+binary"
+
+// Registry is an in-memory OCI distribution registry served by httptest.
+type Registry struct {
+	server *httptest.Server
+
+	mu          sync.Mutex
+	repos       map[string]*repository
+	unavailable bool
+}
+
+type repository struct {
+	blobs     map[digest.Digest][]byte
+	manifests map[digest.Digest]manifest
+	tags      map[string]digest.Digest
+}
+
+type manifest struct {
+	mediaType string
+	content   []byte
+}
+
+// NewRegistry starts a registry that is shut down when the test ends.
+func NewRegistry(t testing.TB) *Registry {
+	t.Helper()
+
+	r := &Registry{
+		repos: map[string]*repository{},
+	}
+
+	r.server = httptest.NewServer(http.HandlerFunc(r.serveHTTP))
+	t.Cleanup(r.server.Close)
+
+	return r
+}
+
+// Host returns the registry's host:port, to be used as reference prefix.
+func (r *Registry) Host() string {
+	u, _ := url.Parse(r.server.URL)
+	return u.Host
+}
+
+// Repo returns the full reference of a repository in this registry.
+func (r *Registry) Repo(name string) string {
+	return r.Host() + "/" + name
+}
+
+// PushBlob stores content in the repository and returns its descriptor.
+func (r *Registry) PushBlob(repo, mediaType string, content []byte) ocispec.Descriptor {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	desc := ocispec.Descriptor{
+		MediaType: mediaType,
+		Digest:    digest.FromBytes(content),
+		Size:      int64(len(content)),
+	}
+
+	r.repo(repo).blobs[desc.Digest] = content
+
+	return desc
+}
+
+// PushManifest stores a manifest or index and tags it. An empty tag pushes
+// the manifest by digest only.
+func (r *Registry) PushManifest(repo, tag, mediaType string, content []byte) ocispec.Descriptor {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	desc := ocispec.Descriptor{
+		MediaType: mediaType,
+		Digest:    digest.FromBytes(content),
+		Size:      int64(len(content)),
+	}
+
+	rp := r.repo(repo)
+	rp.manifests[desc.Digest] = manifest{mediaType: mediaType, content: content}
+
+	if tag != "" {
+		rp.tags[tag] = desc.Digest
+	}
+
+	return desc
+}
+
+// PushBinary publishes data as an artifact named binaryName under tag, the
+// same way `oras push <ref> <binary>` does.
+func (r *Registry) PushBinary(t testing.TB, repo, tag, binaryName string, data []byte) ocispec.Descriptor {
+	t.Helper()
+
+	layer := r.PushBlob(repo, BinaryMediaType, data)
+	layer.Annotations = map[string]string{
+		ocispec.AnnotationTitle: binaryName,
+	}
+
+	return r.PushArtifact(t, repo, tag, []ocispec.Descriptor{layer}, nil)
+}
+
+// PushArtifact publishes an image manifest with an empty config referencing
+// the given layers, which must have been pushed with PushBlob.
+func (r *Registry) PushArtifact(t testing.TB, repo, tag string, layers []ocispec.Descriptor, annotations map[string]string) ocispec.Descriptor {
+	t.Helper()
+
+	config := r.PushBlob(repo, ocispec.MediaTypeEmptyJSON, ocispec.DescriptorEmptyJSON.Data)
+
+	return r.pushManifest(t, repo, tag, config, layers, annotations)
+}
+
+// pushManifest publishes an image manifest with the given config and
+// layers, which must have been pushed with PushBlob.
+func (r *Registry) pushManifest(t testing.TB, repo, tag string, config ocispec.Descriptor, layers []ocispec.Descriptor, annotations map[string]string) ocispec.Descriptor {
+	t.Helper()
+
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+
+	if _, ok := annotations[ocispec.AnnotationCreated]; !ok {
+		annotations[ocispec.AnnotationCreated] = time.Now().UTC().Format(time.RFC3339)
+	}
+
+	m := ocispec.Manifest{
+		MediaType:   ocispec.MediaTypeImageManifest,
+		Config:      config,
+		Layers:      layers,
+		Annotations: annotations,
+	}
+	m.SchemaVersion = 2
+
+	content, err := json.Marshal(m)
+
+	if err != nil {
+		t.Fatalf("failed to marshal manifest: %v", err)
+	}
+
+	return r.PushManifest(repo, tag, ocispec.MediaTypeImageManifest, content)
+}
+
+// PushImage publishes a container image with an image config and a single
+// gzip compressed layer holding files, keyed by their path in the image.
+// Files are executable.
+func (r *Registry) PushImage(t testing.TB, repo, tag string, files map[string][]byte) ocispec.Descriptor {
+	t.Helper()
+
+	var layerTar bytes.Buffer
+
+	tw := tar.NewWriter(&layerTar)
+
+	paths := make([]string, 0, len(files))
+
+	for p := range files {
+		paths = append(paths, p)
+	}
+
+	sort.Strings(paths)
+
+	for _, p := range paths {
+		hdr := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     strings.TrimPrefix(p, "/"),
+			Mode:     0755,
+			Size:     int64(len(files[p])),
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("failed to write layer: %v", err)
+		}
+
+		if _, err := tw.Write(files[p]); err != nil {
+			t.Fatalf("failed to write layer: %v", err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatalf("failed to write layer: %v", err)
+	}
+
+	var buf bytes.Buffer
+
+	gz := gzip.NewWriter(&buf)
+
+	if _, err := gz.Write(layerTar.Bytes()); err != nil {
+		t.Fatalf("failed to compress layer: %v", err)
+	}
+
+	if err := gz.Close(); err != nil {
+		t.Fatalf("failed to compress layer: %v", err)
+	}
+
+	layer := r.PushBlob(repo, ocispec.MediaTypeImageLayerGzip, buf.Bytes())
+
+	image, err := json.Marshal(ocispec.Image{
+		Platform: ocispec.Platform{OS: "linux", Architecture: "amd64"},
+		RootFS: ocispec.RootFS{
+			Type:    "layers",
+			DiffIDs: []digest.Digest{digest.FromBytes(layerTar.Bytes())},
+		},
+	})
+
+	if err != nil {
+		t.Fatalf("failed to marshal image config: %v", err)
+	}
+
+	config := r.PushBlob(repo, ocispec.MediaTypeImageConfig, image)
+
+	return r.pushManifest(t, repo, tag, config, []ocispec.Descriptor{layer}, nil)
+}
+
+// PushIndex publishes an image index under tag referencing the given
+// manifests, which must have been pushed before and carry a Platform.
+func (r *Registry) PushIndex(t testing.TB, repo, tag string, manifests []ocispec.Descriptor) ocispec.Descriptor {
+	t.Helper()
+
+	index := ocispec.Index{
+		MediaType: ocispec.MediaTypeImageIndex,
+		Manifests: manifests,
+	}
+	index.SchemaVersion = 2
+
+	content, err := json.Marshal(index)
+
+	if err != nil {
+		t.Fatalf("failed to marshal index: %v", err)
+	}
+
+	return r.PushManifest(repo, tag, ocispec.MediaTypeImageIndex, content)
+}
+
+// SetUnavailable makes the registry answer every request with 503 Service
+// Unavailable, e.g. to test behaviour while it is unreachable.
+func (r *Registry) SetUnavailable(unavailable bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.unavailable = unavailable
+}
+
+// Tags returns the tags of a repository in sorted order.
+func (r *Registry) Tags(repo string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var tags []string
+
+	for tag := range r.repo(repo).tags {
+		tags = append(tags, tag)
+	}
+
+	sort.Strings(tags)
+
+	return tags
+}
+
+// repo returns the named repository, creating it if needed. The caller must
+// hold r.mu.
+func (r *Registry) repo(name string) *repository {
+	rp, ok := r.repos[name]
+
+	if !ok {
+		rp = &repository{
+			blobs:     map[digest.Digest][]byte{},
+			manifests: map[digest.Digest]manifest{},
+			tags:      map[string]digest.Digest{},
+		}
+		r.repos[name] = rp
+	}
+
+	return rp
+}
+
+func (r *Registry) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	unavailable := r.unavailable
+	r.mu.Unlock()
+
+	if unavailable {
+		writeRegistryError(w, http.StatusServiceUnavailable, "UNAVAILABLE", "registry is unavailable")
+		return
+	}
+
+	path := req.URL.Path
+
+	if path == "/v2/" || path == "/v2" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if !strings.HasPrefix(path, "/v2/") {
+		http.NotFound(w, req)
+		return
+	}
+
+	path = strings.TrimPrefix(path, "/v2/")
+
+	switch {
+	case strings.HasSuffix(path, "/tags/list"):
+		r.serveTags(w, req, strings.TrimSuffix(path, "/tags/list"))
+	case strings.Contains(path, "/manifests/"):
+		name, ref, _ := strings.Cut(path, "/manifests/")
+		r.serveManifest(w, req, name, ref)
+	case strings.Contains(path, "/blobs/uploads/"):
+		name, _, _ := strings.Cut(path, "/blobs/uploads/")
+		r.serveUpload(w, req, name)
+	case strings.Contains(path, "/blobs/"):
+		name, ref, _ := strings.Cut(path, "/blobs/")
+		r.serveBlob(w, req, name, ref)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// serveTags answers the tag list with an ETag and honours If-None-Match, like
+// registries that support conditional requests.
+func (r *Registry) serveTags(w http.ResponseWriter, req *http.Request, name string) {
+	body, _ := json.Marshal(map[string]any{
+		"name": name,
+		"tags": r.Tags(name),
+	})
+
+	etag := `"` + digest.FromBytes(body).Encoded() + `"`
+	w.Header().Set("ETag", etag)
+
+	if req.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+func (r *Registry) serveManifest(w http.ResponseWriter, req *http.Request, name, ref string) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		r.mu.Lock()
+		rp := r.repo(name)
+
+		dgst, ok := rp.tags[ref]
+		if !ok {
+			dgst = digest.Digest(ref)
+		}
+
+		m, ok := rp.manifests[dgst]
+		r.mu.Unlock()
+
+		if !ok {
+			writeRegistryError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown")
+			return
+		}
+
+		w.Header().Set("Content-Type", m.mediaType)
+		w.Header().Set("Docker-Content-Digest", dgst.String())
+		w.Header().Set("Content-Length", fmt.Sprint(len(m.content)))
+		w.WriteHeader(http.StatusOK)
+
+		if req.Method == http.MethodGet {
+			w.Write(m.content)
+		}
+	case http.MethodPut:
+		content, err := io.ReadAll(req.Body)
+
+		if err != nil {
+			writeRegistryError(w, http.StatusBadRequest, "MANIFEST_INVALID", err.Error())
+			return
+		}
+
+		tag := ref
+		if _, err := digest.Parse(ref); err == nil {
+			tag = ""
+		}
+
+		desc := r.PushManifest(name, tag, req.Header.Get("Content-Type"), content)
+
+		w.Header().Set("Docker-Content-Digest", desc.Digest.String())
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (r *Registry) serveBlob(w http.ResponseWriter, req *http.Request, name, ref string) {
+	r.mu.Lock()
+	content, ok := r.repo(name).blobs[digest.Digest(ref)]
+	r.mu.Unlock()
+
+	if !ok {
+		writeRegistryError(w, http.StatusNotFound, "BLOB_UNKNOWN", "blob unknown")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Docker-Content-Digest", ref)
+
+	// ServeContent handles HEAD and range requests
+	http.ServeContent(w, req, "", time.Time{}, bytes.NewReader(content))
+}
+
+// serveUpload implements monolithic blob uploads: POST to start, PUT with
+// the digest to complete.
+func (r *Registry) serveUpload(w http.ResponseWriter, req *http.Request, name string) {
+	switch req.Method {
+	case http.MethodPost:
+		w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/uploads/%d", name, time.Now().UnixNano()))
+		w.WriteHeader(http.StatusAccepted)
+	case http.MethodPut:
+		content, err := io.ReadAll(req.Body)
+
+		if err != nil {
+			writeRegistryError(w, http.StatusBadRequest, "BLOB_UPLOAD_INVALID", err.Error())
+			return
+		}
+
+		dgst := digest.Digest(req.URL.Query().Get("digest"))
+
+		if dgst != digest.FromBytes(content) {
+			writeRegistryError(w, http.StatusBadRequest, "DIGEST_INVALID", "digest does not match content")
+			return
+		}
+
+		r.PushBlob(name, "", content)
+
+		w.Header().Set("Docker-Content-Digest", dgst.String())
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func writeRegistryError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(map[string]any{
+		"errors": []map[string]string{{"code": code, "message": message}},
+	})
+}
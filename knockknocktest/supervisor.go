@@ -0,0 +1,123 @@
+package knockknocktest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zeitlos/knockknock/config"
+	"github.com/zeitlos/knockknock/internal/testhook"
+	"github.com/zeitlos/knockknock/ipc"
+	"github.com/zeitlos/knockknock/supervisor"
+)
+
+// Supervisor is a real supervisor.Supervisor serving its IPC socket inside the
+// test process. Instead of terminating the process after an update or
+// rollback, activated versions are reported on Restarts.
+type Supervisor struct {
+	*supervisor.Supervisor
+
+	Config *config.Config
+	Client *ipc.Client
+
+	server   *ipc.Server
+	restarts chan string
+}
+
+// NewConfig returns a config for binaryName pointing at the registry
+// repository and installation, with the socket in a temporary directory.
+func NewConfig(t testing.TB, reg *Registry, inst *Installation, version string) *config.Config {
+	t.Helper()
+
+	return config.New(inst.BinaryName).
+		WithRepo(reg.Repo(inst.BinaryName)).
+		WithPlainHTTP().
+		WithVersion(version).
+		WithInstallationDir(inst.Dir).
+		WithRuntimeDir(t.TempDir())
+}
+
+// StartSupervisor starts a supervisor and its IPC server for cfg and connects
+// a client to it. Both are shut down when the test ends. The child process
+// is only started by Run.
+func StartSupervisor(t testing.TB, cfg *config.Config) *Supervisor {
+	t.Helper()
+
+	h := &Supervisor{
+		Config:   cfg,
+		restarts: make(chan string, 16),
+	}
+
+	testhook.SetRestartFunc(cfg, func(version string) error {
+		h.restarts <- version
+		return nil
+	})
+	t.Cleanup(func() { testhook.SetRestartFunc(cfg, nil) })
+
+	sv, err := supervisor.New(cfg)
+
+	if err != nil {
+		t.Fatalf("failed to create supervisor: %v", err)
+	}
+
+	server, err := ipc.NewIPCServer(sv)
+
+	if err != nil {
+		t.Fatalf("failed to create ipc server: %v", err)
+	}
+
+	server.Serve()
+	t.Cleanup(func() { server.Close() })
+
+	client, err := ipc.NewClient(sv.SocketPath())
+
+	if err != nil {
+		t.Fatalf("failed to create ipc client: %v", err)
+	}
+
+	h.Supervisor = sv
+	h.server = server
+	h.Client = client
+
+	return h
+}
+
+// Run supervises the configured child command in the background until the
+// test ends. Use config.WithCommand to choose the child, for example a shell
+// command that exits non-zero to simulate a crash loop.
+func (h *Supervisor) Run(t testing.TB) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		h.RunContext(ctx)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+// Restarts receives the version activated each time the supervisor would
+// have restarted the process.
+func (h *Supervisor) Restarts() <-chan string {
+	return h.restarts
+}
+
+// WaitForRestart waits until the supervisor restarts and returns the
+// activated version. The test fails when timeout elapses first.
+func (h *Supervisor) WaitForRestart(t testing.TB, timeout time.Duration) string {
+	t.Helper()
+
+	select {
+	case version := <-h.restarts:
+		return version
+	case <-time.After(timeout):
+		t.Fatalf("supervisor did not restart within %s", timeout)
+		return ""
+	}
+}
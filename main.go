@@ -1,15 +1,30 @@
 package knockknock
 
 import (
+	"context"
+	"fmt"
 	"log/slog"
 	"os"
+	"runtime/debug"
+	"time"
 
 	"github.com/zeitlos/knockknock/config"
 	"github.com/zeitlos/knockknock/ipc"
 	"github.com/zeitlos/knockknock/supervisor"
 )
 
-var ipcClient *ipc.Client
+// Exit codes the child can exit with to control the supervisor instead of
+// being counted as a crash.
+const (
+	ExitRestart  = supervisor.ExitRestart
+	ExitStop     = supervisor.ExitStop
+	ExitRollback = supervisor.ExitRollback
+)
+
+var (
+	ipcClient   *ipc.Client
+	childConfig *config.Config
+)
 
 func Client() *ipc.Client {
 	if ipcClient == nil {
@@ -23,7 +38,12 @@ func Client() *ipc.Client {
 func Run(config *config.Config, userMain func()) {
 	var err error
 
-	socketPath := supervisor.SocketPath()
+	if supervisor.IsSupervisorProcess() && isDevMode(config) {
+		runDev(config, userMain)
+		return
+	}
+
+	socketPath := supervisor.SocketPath(config)
 
 	// Check if we're the supervisor or the child
 	if supervisor.IsSupervisorProcess() {
@@ -62,15 +82,72 @@ func Run(config *config.Config, userMain func()) {
 		os.Exit(1)
 	}
 
+	childConfig = config
+
+	if !config.ManualReady {
+		if err := Ready(context.Background()); err != nil {
+			slog.Warn("failed to say hello to supervisor", "error", err)
+		}
+	}
+
 	runAsChild(userMain)
 }
 
+// Ready tells the supervisor that the app has started. Run calls it before
+// the app's main function unless config.ManualReady is set, in which case
+// the app calls it once it is initialised.
+func Ready(ctx context.Context) error {
+	// Without a supervisor, e.g. in dev mode, nobody is waiting
+	if supervisor.IsSupervisorProcess() || !Client().HasCapability(ipc.CapabilityHello) {
+		return nil
+	}
+
+	hello, err := Client().Hello(ctx, childConfig.Version)
+
+	if err != nil {
+		return err
+	}
+
+	if hello.HeartbeatInterval > 0 {
+		go heartbeat(time.Duration(hello.HeartbeatInterval*float64(time.Second)), childConfig.Liveness)
+	}
+
+	return nil
+}
+
+// heartbeat keeps the supervisor's watchdog satisfied for as long as the
+// liveness check, if any, passes.
+func heartbeat(interval time.Duration, liveness func(ctx context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+
+		if liveness != nil {
+			if err := liveness(ctx); err != nil {
+				slog.Warn("liveness check failed, withholding heartbeat", "error", err)
+				cancel()
+				continue
+			}
+		}
+
+		if err := Client().Heartbeat(ctx); err != nil {
+			slog.Warn("failed to send heartbeat", "error", err)
+		}
+
+		cancel()
+	}
+}
+
 func runAsChild(userMain func()) {
 	// Basic panic recovery for Go panics
 	defer func() {
 		if r := recover(); r != nil {
-			slog.Error("Panic recovered: %v", r)
-			os.Exit(1) // Signal crash to supervisor
+			// Print the panic like the runtime does, so the supervisor can
+			// parse it into the crash report
+			fmt.Fprintf(os.Stderr, "panic: %v\n\n%s", r, debug.Stack())
+			os.Exit(2) // Signal crash to supervisor
 		}
 	}()
 
@@ -0,0 +1,472 @@
+package oras
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/zeitlos/knockknock/source"
+
+	"oras.land/oras-go/v2/registry/remote"
+	"oras.land/oras-go/v2/registry/remote/auth"
+)
+
+const (
+	// blobRetries is how often an interrupted blob download is resumed
+	// before the update fails.
+	blobRetries    = 5
+	blobRetryDelay = 2 * time.Second
+
+	partialSuffix = ".partial"
+
+	// annotationUnpack marks layers `oras push` created from a directory.
+	annotationUnpack = "io.deis.oras.content.unpack"
+)
+
+var errBlobCorrupt = errors.New("downloaded blob does not match its digest")
+
+var _ source.TransferCounter = (*Client)(nil)
+
+// blobCache keeps verified blobs by digest, next to the partial downloads of
+// blobs that were interrupted.
+type blobCache struct {
+	dir     string
+	maxSize int64
+}
+
+func (c blobCache) path(dgst digest.Digest) string {
+	return filepath.Join(c.dir, dgst.Algorithm().String(), dgst.Encoded())
+}
+
+// prune removes the least recently used files until the cache fits into
+// its maximum size.
+func (c blobCache) prune() error {
+	type cached struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+
+	var files []cached
+	var total int64
+
+	err := filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+
+		if err != nil {
+			return err
+		}
+
+		files = append(files, cached{path: path, size: info.Size(), modTime: info.ModTime()})
+		total += info.Size()
+
+		return nil
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to read download cache: %w", err)
+	}
+
+	slices.SortFunc(files, func(a, b cached) int {
+		return a.modTime.Compare(b.modTime)
+	})
+
+	for _, f := range files {
+		if total <= c.maxSize {
+			break
+		}
+
+		if err := os.Remove(f.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to remove cached blob: %w", err)
+		}
+
+		total -= f.size
+	}
+
+	return nil
+}
+
+// CountTransfers calls fn with the bytes of every blob read from the
+// registry. Cache hits and the part of a resumed download already on disk
+// are not counted.
+func (r *Client) CountTransfers(fn func(n int64)) {
+	r.transferred = fn
+}
+
+// fetchBlob returns the path of the verified blob desc in the download
+// cache, downloading it first if needed. Interrupted downloads are resumed
+// where they stopped, also across restarts. progress is called with the
+// number of bytes of the blob present so far.
+func (r *Client) fetchBlob(ctx context.Context, desc ocispec.Descriptor, progress func(done int64)) (string, error) {
+	if err := desc.Digest.Validate(); err != nil {
+		return "", fmt.Errorf("invalid digest for blob: %w", err)
+	}
+
+	file := r.cache.path(desc.Digest)
+
+	if info, err := os.Stat(file); err == nil {
+		// Cached blobs were verified when they were added, but the file may
+		// have been damaged on disk since
+		err := verifyFile(file, desc)
+
+		if err == nil {
+			// Touch it, the cache evicts least recently used blobs first
+			now := time.Now()
+			os.Chtimes(file, now, now)
+
+			progress(desc.Size)
+
+			return file, nil
+		}
+
+		slog.Warn("cached blob is corrupt, downloading it again", "digest", desc.Digest, "size", info.Size(), "error", err)
+
+		if err := os.Remove(file); err != nil {
+			return "", fmt.Errorf("failed to remove corrupt blob %s: %w", desc.Digest, err)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return "", fmt.Errorf("failed to create download cache: %w", err)
+	}
+
+	partial := file + partialSuffix
+
+	for attempt := 1; ; attempt++ {
+		err := r.resumeBlob(ctx, desc, partial, progress)
+
+		if err == nil {
+			break
+		}
+
+		if errors.Is(err, errBlobCorrupt) {
+			os.Remove(partial)
+		}
+
+		if ctx.Err() != nil || attempt > blobRetries {
+			return "", err
+		}
+
+		slog.Warn("blob download interrupted, resuming", "digest", desc.Digest, "attempt", attempt, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(time.Duration(attempt) * blobRetryDelay):
+		}
+	}
+
+	if err := os.Rename(partial, file); err != nil {
+		return "", fmt.Errorf("failed to move blob %s into the cache: %w", desc.Digest, err)
+	}
+
+	return file, nil
+}
+
+// resumeBlob downloads the rest of desc into the partial file and verifies
+// the completed file.
+func (r *Client) resumeBlob(ctx context.Context, desc ocispec.Descriptor, partial string, progress func(done int64)) error {
+	f, err := os.OpenFile(partial, os.O_CREATE|os.O_RDWR, 0644)
+
+	if err != nil {
+		return fmt.Errorf("failed to open partial blob: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+
+	if err != nil {
+		return fmt.Errorf("failed to read partial blob: %w", err)
+	}
+
+	offset := info.Size()
+
+	if offset > desc.Size {
+		offset = 0
+	}
+
+	if offset < desc.Size {
+		body, start, err := r.openBlob(ctx, desc, offset)
+
+		if err != nil {
+			return err
+		}
+		defer body.Close()
+
+		if start > 0 {
+			slog.Info("resuming blob download", "digest", desc.Digest, "offset", start, "size", desc.Size)
+		}
+
+		if err := f.Truncate(start); err != nil {
+			return fmt.Errorf("failed to truncate partial blob: %w", err)
+		}
+
+		if _, err := f.Seek(start, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to seek partial blob: %w", err)
+		}
+
+		done := start
+		progress(done)
+
+		counter := progressWriter(func(n int64) {
+			done += n
+			progress(done)
+		})
+
+		var network io.Reader = body
+
+		if r.transferred != nil {
+			network = io.TeeReader(body, progressWriter(r.transferred))
+		}
+
+		body = readCloser{newLimitedReader(ctx, io.LimitReader(network, desc.Size-start), r.limiter), body}
+
+		if _, err := io.Copy(io.MultiWriter(f, counter), body); err != nil {
+			return fmt.Errorf("failed to download blob %s: %w", desc.Digest, err)
+		}
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek partial blob: %w", err)
+	}
+
+	verifier := desc.Digest.Verifier()
+
+	n, err := io.Copy(verifier, f)
+
+	if err != nil {
+		return fmt.Errorf("failed to read partial blob: %w", err)
+	}
+
+	// A connection closed early is resumed, wrong content starts over
+	if n < desc.Size {
+		return fmt.Errorf("blob %s is incomplete, got %d of %d bytes", desc.Digest, n, desc.Size)
+	}
+
+	if !verifier.Verified() {
+		return fmt.Errorf("%w: %s", errBlobCorrupt, desc.Digest)
+	}
+
+	return nil
+}
+
+// verifyFile checks the file at path against the size and digest of desc.
+func verifyFile(path string, desc ocispec.Descriptor) error {
+	f, err := os.Open(path)
+
+	if err != nil {
+		return fmt.Errorf("failed to open blob: %w", err)
+	}
+	defer f.Close()
+
+	verifier := desc.Digest.Verifier()
+
+	n, err := io.Copy(verifier, f)
+
+	if err != nil {
+		return fmt.Errorf("failed to read blob: %w", err)
+	}
+
+	if n != desc.Size || !verifier.Verified() {
+		return fmt.Errorf("%w: %s", errBlobCorrupt, desc.Digest)
+	}
+
+	return nil
+}
+
+// openBlob returns the content of desc from offset on, and the offset it
+// actually starts at, since registries may ignore the range and send all
+// of it.
+func (r *Client) openBlob(ctx context.Context, desc ocispec.Descriptor, offset int64) (io.ReadCloser, int64, error) {
+	repo, ok := r.oras.(*remote.Repository)
+
+	// Layouts are read from disk, there is nothing to resume
+	if !ok || offset == 0 {
+		rc, err := r.oras.Fetch(ctx, desc)
+
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to fetch blob %s: %w", desc.Digest, err)
+		}
+
+		return rc, 0, nil
+	}
+
+	ctx = auth.AppendRepositoryScope(ctx, repo.Reference, auth.ActionPull)
+
+	url := fmt.Sprintf("%s%s/blobs/%s", baseURL(repo), repo.Reference.Repository, desc.Digest)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+
+	resp, err := repo.Client.Do(req)
+
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch blob %s: %w", desc.Digest, err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		if !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)) {
+			resp.Body.Close()
+			return nil, 0, fmt.Errorf("unexpected content range '%s' for blob %s", resp.Header.Get("Content-Range"), desc.Digest)
+		}
+
+		return resp.Body, offset, nil
+	case http.StatusOK:
+		return resp.Body, 0, nil
+	default:
+		resp.Body.Close()
+		return nil, 0, fmt.Errorf("failed to fetch blob %s: unexpected status %s", desc.Digest, resp.Status)
+	}
+}
+
+// copyFile copies a cached blob to dest, creating its parent directories.
+func copyFile(src, dest string, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", filepath.Base(dest), err)
+	}
+
+	in, err := os.Open(src)
+
+	if err != nil {
+		return fmt.Errorf("failed to open cached blob: %w", err)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dest, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Base(dest), err)
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(dest), err)
+	}
+
+	// The mode passed to OpenFile is ignored for existing files
+	if err := out.Chmod(mode); err != nil {
+		return fmt.Errorf("failed to chmod %s: %w", filepath.Base(dest), err)
+	}
+
+	return out.Close()
+}
+
+// progressWriter calls progress with the size of every write.
+type progressWriter func(n int64)
+
+func (p progressWriter) Write(b []byte) (int, error) {
+	p(int64(len(b)))
+
+	return len(b), nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// rateLimiter spaces out reads so they average at most rate bytes per
+// second.
+type rateLimiter struct {
+	rate int64
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+func newRateLimiter(bytesPerSecond int64) *rateLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+
+	return &rateLimiter{rate: bytesPerSecond}
+}
+
+// wait blocks until n more bytes may be read.
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+
+	now := time.Now()
+
+	if l.next.Before(now) {
+		l.next = now
+	}
+
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / l.rate))
+
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(delay):
+		return nil
+	}
+}
+
+type limitedReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *rateLimiter
+}
+
+// newLimitedReader returns r read at the pace of limiter, which may be nil.
+func newLimitedReader(ctx context.Context, r io.Reader, limiter *rateLimiter) io.Reader {
+	if limiter == nil {
+		return r
+	}
+
+	return &limitedReader{ctx: ctx, r: r, limiter: limiter}
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	// Small reads keep the pace even
+	if chunk := max(int(l.limiter.rate/10), 1); len(p) > chunk {
+		p = p[:chunk]
+	}
+
+	n, err := l.r.Read(p)
+
+	if n > 0 {
+		if err := l.limiter.wait(l.ctx, n); err != nil {
+			return n, err
+		}
+	}
+
+	return n, err
+}
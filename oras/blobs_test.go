@@ -0,0 +1,413 @@
+package oras
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/zeitlos/knockknock/config"
+)
+
+// blobServer serves a single blob the way serve decides, and records the
+// Range header of every request.
+type blobServer struct {
+	blob []byte
+	desc ocispec.Descriptor
+
+	mu     sync.Mutex
+	ranges []string
+	serve  func(w http.ResponseWriter, r *http.Request, request int)
+}
+
+func newBlobServer(t *testing.T, blob []byte, serve func(w http.ResponseWriter, r *http.Request, request int)) (*blobServer, *Client) {
+	t.Helper()
+
+	b := &blobServer{
+		blob: blob,
+		desc: ocispec.Descriptor{
+			MediaType: ocispec.MediaTypeImageLayer,
+			Digest:    digest.FromBytes(blob),
+			Size:      int64(len(blob)),
+		},
+		serve: serve,
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/app/blobs/"+b.desc.Digest.String() {
+			http.NotFound(w, r)
+			return
+		}
+
+		b.mu.Lock()
+		b.ranges = append(b.ranges, r.Header.Get("Range"))
+		request := len(b.ranges)
+		b.mu.Unlock()
+
+		b.serve(w, r, request)
+	}))
+	t.Cleanup(server.Close)
+
+	repo, err := newRepository(strings.TrimPrefix(server.URL, "http://")+"/app", &config.AuthConfig{}, nil, true, "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.New("app").
+		WithVersion("1.0.0").
+		WithInstallationDir(t.TempDir())
+
+	client, err := newClient(cfg, repo)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b, client
+}
+
+func (b *blobServer) requests() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]string(nil), b.ranges...)
+}
+
+// serveFrom sends the blob from offset on, as a 206 if offset is set.
+func (b *blobServer) serveFrom(w http.ResponseWriter, offset int) {
+	w.Header().Set("Content-Length", strconv.Itoa(len(b.blob)-offset))
+
+	if offset > 0 {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, len(b.blob)-1, len(b.blob)))
+		w.WriteHeader(http.StatusPartialContent)
+	}
+
+	w.Write(b.blob[offset:])
+}
+
+func requestedOffset(r *http.Request) int {
+	offset, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(r.Header.Get("Range"), "bytes="), "-"))
+
+	return offset
+}
+
+func testBlob() []byte {
+	return bytes.Repeat([]byte("knockknock"), 1000)
+}
+
+func TestResumeBlobAfterCutConnection(t *testing.T) {
+	cut := 4000
+
+	b, client := newBlobServer(t, testBlob(), func(w http.ResponseWriter, r *http.Request, request int) {
+		if request == 1 {
+			// Promise the whole blob, then drop the connection
+			w.Header().Set("Content-Length", strconv.Itoa(len(testBlob())))
+			w.Write(testBlob()[:cut])
+			w.(http.Flusher).Flush()
+
+			panic(http.ErrAbortHandler)
+		}
+
+		blob := testBlob()
+		offset := requestedOffset(r)
+
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, len(blob)-1, len(blob)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(blob[offset:])
+	})
+
+	var transferred int64
+
+	client.CountTransfers(func(n int64) {
+		transferred += n
+	})
+
+	var progress []int64
+
+	partial := client.cache.path(b.desc.Digest) + partialSuffix
+
+	if err := os.MkdirAll(filepath.Dir(partial), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	err := client.resumeBlob(context.Background(), b.desc, partial, func(done int64) {
+		progress = append(progress, done)
+	})
+
+	if err == nil {
+		t.Fatal("expected the cut connection to fail the download")
+	}
+
+	if errors.Is(err, errBlobCorrupt) {
+		t.Fatalf("an incomplete blob must be resumed, not discarded: %v", err)
+	}
+
+	if info, err := os.Stat(partial); err != nil || info.Size() != int64(cut) {
+		t.Fatalf("expected %d bytes to be kept, got %v", cut, info)
+	}
+
+	progress = nil
+
+	if err := client.resumeBlob(context.Background(), b.desc, partial, func(done int64) {
+		progress = append(progress, done)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := b.requests(); len(got) != 2 || got[0] != "" || got[1] != fmt.Sprintf("bytes=%d-", cut) {
+		t.Fatalf("expected a range request from %d, got %q", cut, got)
+	}
+
+	if progress[0] != int64(cut) || progress[len(progress)-1] != b.desc.Size {
+		t.Fatalf("expected progress from %d to %d, got %v", cut, b.desc.Size, progress)
+	}
+
+	// Every byte crossed the network once
+	if transferred != b.desc.Size {
+		t.Fatalf("expected %d bytes transferred, got %d", b.desc.Size, transferred)
+	}
+
+	if data, _ := os.ReadFile(partial); !bytes.Equal(data, testBlob()) {
+		t.Fatal("resumed blob does not match")
+	}
+}
+
+func TestResumeBlobRangeIgnored(t *testing.T) {
+	b, client := newBlobServer(t, testBlob(), nil)
+
+	b.serve = func(w http.ResponseWriter, r *http.Request, request int) {
+		b.serveFrom(w, 0)
+	}
+
+	partial := filepath.Join(t.TempDir(), "blob"+partialSuffix)
+
+	// Garbage that would corrupt the blob if it was appended to
+	if err := os.WriteFile(partial, bytes.Repeat([]byte("x"), 3000), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.resumeBlob(context.Background(), b.desc, partial, func(int64) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := b.requests(); len(got) != 1 || got[0] != "bytes=3000-" {
+		t.Fatalf("expected a range request, got %q", got)
+	}
+
+	if data, _ := os.ReadFile(partial); !bytes.Equal(data, testBlob()) {
+		t.Fatal("expected the partial blob to be replaced by the full response")
+	}
+}
+
+func TestResumeBlobRejectsContentRange(t *testing.T) {
+	tests := []struct {
+		name         string
+		contentRange string
+	}{
+		{name: "wrong offset", contentRange: "bytes 0-9999/10000"},
+		{name: "missing", contentRange: ""},
+		{name: "not bytes", contentRange: "items 3000-9999/10000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, client := newBlobServer(t, testBlob(), func(w http.ResponseWriter, r *http.Request, request int) {
+				if tt.contentRange != "" {
+					w.Header().Set("Content-Range", tt.contentRange)
+				}
+
+				w.WriteHeader(http.StatusPartialContent)
+				w.Write(testBlob())
+			})
+
+			partial := filepath.Join(t.TempDir(), "blob"+partialSuffix)
+			kept := testBlob()[:3000]
+
+			if err := os.WriteFile(partial, kept, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			err := client.resumeBlob(context.Background(), b.desc, partial, func(int64) {})
+
+			if err == nil || !strings.Contains(err.Error(), "unexpected content range") {
+				t.Fatalf("expected a content range error, got %v", err)
+			}
+
+			if data, _ := os.ReadFile(partial); !bytes.Equal(data, kept) {
+				t.Fatal("expected the partial blob to be left alone")
+			}
+		})
+	}
+}
+
+func TestFetchBlobReplacesCorruptCache(t *testing.T) {
+	b, client := newBlobServer(t, testBlob(), nil)
+
+	b.serve = func(w http.ResponseWriter, r *http.Request, request int) {
+		b.serveFrom(w, requestedOffset(r))
+	}
+
+	var transferred int64
+
+	client.CountTransfers(func(n int64) {
+		transferred += n
+	})
+
+	file := client.cache.path(b.desc.Digest)
+
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// The right size, but truncated and padded
+	corrupt := append(testBlob()[:5000], make([]byte, 5000)...)
+
+	if err := os.WriteFile(file, corrupt, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := client.fetchBlob(context.Background(), b.desc, func(int64) {})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data, _ := os.ReadFile(path); !bytes.Equal(data, testBlob()) {
+		t.Fatal("expected the corrupt blob to be downloaded again")
+	}
+
+	// A second fetch is served from the cache
+	transferred = 0
+
+	if _, err := client.fetchBlob(context.Background(), b.desc, func(int64) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := b.requests(); len(got) != 1 {
+		t.Fatalf("expected a single download, got %d requests", len(got))
+	}
+
+	if transferred != 0 {
+		t.Fatalf("expected a cache hit not to count as transferred, got %d bytes", transferred)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	blob := testBlob()
+
+	b, client := newBlobServer(t, blob, nil)
+
+	b.serve = func(w http.ResponseWriter, r *http.Request, request int) {
+		b.serveFrom(w, 0)
+	}
+
+	// 10000 bytes at 25000 bytes per second, read in 2500 byte chunks of
+	// which the first isn't delayed
+	client.limiter = newRateLimiter(25000)
+
+	partial := filepath.Join(t.TempDir(), "blob"+partialSuffix)
+
+	start := time.Now()
+
+	if err := client.resumeBlob(context.Background(), b.desc, partial, func(int64) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond {
+		t.Fatalf("expected the download to take at least 250ms, took %s", elapsed)
+	}
+
+	// A canceled download stops waiting for the limiter
+	os.Remove(partial)
+
+	client.limiter = newRateLimiter(1000)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start = time.Now()
+
+	if err := client.resumeBlob(ctx, b.desc, partial, func(int64) {}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline to cancel the download, got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("cancellation took %s", elapsed)
+	}
+
+	if newRateLimiter(0) != nil {
+		t.Fatal("expected no limiter without a rate")
+	}
+}
+
+func TestBlobCachePrune(t *testing.T) {
+	cache := blobCache{dir: t.TempDir(), maxSize: 2000}
+	now := time.Now()
+
+	files := []struct {
+		name string
+		size int
+		age  time.Duration
+	}{
+		{name: "sha256/oldest", size: 1000, age: 3 * time.Hour},
+		{name: "sha256/old", size: 1000, age: 2 * time.Hour},
+		{name: "sha256/recent", size: 1000, age: time.Hour},
+		{name: "sha256/partial" + partialSuffix, size: 500, age: 0},
+	}
+
+	for _, f := range files {
+		path := filepath.Join(cache.dir, f.name)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, make([]byte, f.size), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.Chtimes(path, now.Add(-f.age), now.Add(-f.age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := cache.prune(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 3500 bytes, the two least recently used go to fit into 2000
+	for _, f := range files {
+		_, err := os.Stat(filepath.Join(cache.dir, f.name))
+		evicted := f.name == "sha256/oldest" || f.name == "sha256/old"
+
+		if evicted != errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s: expected evicted=%v, got %v", f.name, evicted, err)
+		}
+	}
+
+	// Within the limit nothing is removed
+	if err := cache.prune(); err != nil {
+		t.Fatal(err)
+	}
+
+	if entries, _ := os.ReadDir(filepath.Join(cache.dir, "sha256")); len(entries) != 2 {
+		t.Fatalf("expected 2 files to remain, got %d", len(entries))
+	}
+
+	// A cache that was never created is empty
+	if err := (blobCache{dir: filepath.Join(cache.dir, "missing"), maxSize: 0}).prune(); err != nil {
+		t.Fatal(err)
+	}
+}
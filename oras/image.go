@@ -0,0 +1,300 @@
+package oras
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Config media types of container images.
+var imageConfigMediaTypes = map[string]bool{
+	ocispec.MediaTypeImageConfig:                     true,
+	"application/vnd.docker.container.image.v1+json": true,
+}
+
+// Layer media types of container images. Docker images use their own media
+// types for the same formats.
+var imageLayerMediaTypes = map[string]bool{
+	ocispec.MediaTypeImageLayer:                                    true,
+	ocispec.MediaTypeImageLayerGzip:                                true,
+	ocispec.MediaTypeImageLayerZstd:                                true,
+	"application/vnd.docker.image.rootfs.diff.tar.gzip":            true,
+	"application/vnd.docker.image.rootfs.diff.tar":                 true,
+	"application/vnd.docker.image.rootfs.foreign.diff.tar.gzip":    true,
+	"application/vnd.oci.image.layer.nondistributable.v1.tar":      true,
+	"application/vnd.oci.image.layer.nondistributable.v1.tar+gzip": true,
+	"application/vnd.oci.image.layer.nondistributable.v1.tar+zstd": true,
+}
+
+const (
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = ".wh..wh..opq"
+
+	// maxLinkHops bounds how many symlinks are followed to the binary.
+	maxLinkHops = 10
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// isImage reports whether manifest is a container image with filesystem
+// layers, rather than an artifact carrying the binary as a file. Artifacts
+// pushed with oras may use tar layer media types too, so only the config
+// tells them apart.
+func isImage(manifest ocispec.Manifest) bool {
+	return imageConfigMediaTypes[manifest.Config.MediaType]
+}
+
+// checkImageLayers returns an error if a layer of the image is not a
+// filesystem layer the binary can be extracted from.
+func checkImageLayers(manifest ocispec.Manifest) error {
+	for _, layer := range manifest.Layers {
+		if !imageLayerMediaTypes[layer.MediaType] {
+			return fmt.Errorf("unsupported layer media type '%s' in image", layer.MediaType)
+		}
+	}
+
+	return nil
+}
+
+// imagePath returns the path of the binary inside container images, without
+// leading slash.
+func (r *Client) imagePath() string {
+	p := r.config.ImagePath
+
+	if p == "" {
+		p = "/usr/local/bin/" + r.config.BinaryName
+	}
+
+	return strings.TrimPrefix(path.Clean("/"+p), "/")
+}
+
+// extractImage extracts the binary at the configured image path from the
+// downloaded layers of an image into destDir. Layers are applied in order,
+// honouring whiteouts.
+func (r *Client) extractImage(layers []string, destDir string) error {
+	target := r.imagePath()
+	searched := layers
+
+	for hops := 0; ; hops++ {
+		if hops > maxLinkHops {
+			return fmt.Errorf("too many links resolving /%s in image", r.imagePath())
+		}
+
+		entry, err := locate(searched, target)
+		searched = layers
+
+		if err != nil {
+			return err
+		}
+
+		if entry == nil {
+			return fmt.Errorf("/%s not found in image", target)
+		}
+
+		// The path below a parent that is not a directory
+		rest := strings.TrimPrefix(target, entry.name)
+
+		switch {
+		case entry.header.Typeflag == tar.TypeReg && rest == "":
+			return extractEntry(layers[entry.layer], target, filepath.Join(destDir, r.config.BinaryName))
+		case entry.header.Typeflag == tar.TypeSymlink:
+			link := entry.header.Linkname
+
+			if !path.IsAbs(link) {
+				link = path.Join(path.Dir(entry.name), link)
+			}
+
+			target = cleanEntryName(link + rest)
+		case entry.header.Typeflag == tar.TypeLink && rest == "":
+			// Hard links point to a file that existed when the link was
+			// added, earlier in the same layer or in a lower one
+			target = cleanEntryName(entry.header.Linkname)
+			searched = layers[:entry.layer+1]
+		default:
+			return fmt.Errorf("/%s in image is not a regular file", target)
+		}
+	}
+}
+
+type layerEntry struct {
+	layer  int
+	name   string
+	header *tar.Header
+}
+
+// locate returns the topmost entry for target or one of its parents that is
+// not a directory in the union of layers, or nil if the topmost layer
+// touching it deletes it.
+func locate(layers []string, target string) (*layerEntry, error) {
+	var found *layerEntry
+
+	for i, layer := range layers {
+		var entry *layerEntry
+		var hidden bool
+
+		err := walkLayer(layer, func(hdr *tar.Header, r io.Reader) error {
+			name := cleanEntryName(hdr.Name)
+			dir, base := path.Split(name)
+			dir = strings.TrimSuffix(dir, "/")
+
+			switch {
+			case base == whiteoutOpaque:
+				// The directory's contents in lower layers are hidden
+				hidden = hidden || isWithin(target, dir)
+			case strings.HasPrefix(base, whiteoutPrefix):
+				hidden = hidden || isWithin(target, path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix))) ||
+					target == path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix))
+			case name == target, isWithin(target, name) && hdr.Typeflag != tar.TypeDir:
+				// Either the target itself or a parent directory replaced by
+				// something else, such as a symlink
+				entry = &layerEntry{layer: i, name: name, header: hdr}
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		// Whiteouts only affect lower layers, so an entry in the same layer
+		// survives them
+		if hidden {
+			found = nil
+		}
+
+		if entry != nil {
+			found = entry
+		}
+	}
+
+	return found, nil
+}
+
+// extractEntry copies target from a layer into dest.
+func extractEntry(layer, target, dest string) error {
+	tmp := dest + ".tmp"
+
+	errFound := errors.New("found")
+
+	err := walkLayer(layer, func(hdr *tar.Header, r io.Reader) error {
+		if cleanEntryName(hdr.Name) != target || hdr.Typeflag != tar.TypeReg {
+			return nil
+		}
+
+		f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+
+		if err != nil {
+			return fmt.Errorf("failed to create binary: %w", err)
+		}
+		defer f.Close()
+
+		if _, err := io.Copy(f, r); err != nil {
+			return fmt.Errorf("failed to extract binary: %w", err)
+		}
+
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("failed to write binary: %w", err)
+		}
+
+		return errFound
+	})
+
+	if !errors.Is(err, errFound) {
+		os.Remove(tmp)
+
+		if err == nil {
+			err = fmt.Errorf("/%s vanished from layer", target)
+		}
+
+		return err
+	}
+
+	if err := os.Rename(tmp, dest); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to move binary into place: %w", err)
+	}
+
+	return nil
+}
+
+// walkLayer calls fn for every entry of a tar layer, which may be gzip or
+// zstd compressed. Iteration stops at the first error returned by fn.
+func walkLayer(layer string, fn func(hdr *tar.Header, r io.Reader) error) error {
+	f, err := os.Open(layer)
+
+	if err != nil {
+		return fmt.Errorf("failed to open layer: %w", err)
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	magic, _ := br.Peek(4)
+
+	var r io.Reader = br
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gz, err := gzip.NewReader(br)
+
+		if err != nil {
+			return fmt.Errorf("failed to decompress layer: %w", err)
+		}
+		defer gz.Close()
+
+		r = gz
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(br)
+
+		if err != nil {
+			return fmt.Errorf("failed to decompress layer: %w", err)
+		}
+		defer zr.Close()
+
+		r = zr
+	}
+
+	tr := tar.NewReader(r)
+
+	for {
+		hdr, err := tr.Next()
+
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to read layer: %w", err)
+		}
+
+		if err := fn(hdr, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// cleanEntryName normalises a tar entry name to a relative path without
+// leading "./" or "/".
+func cleanEntryName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// isWithin reports whether p lies below dir. The root directory is the
+// empty string.
+func isWithin(p, dir string) bool {
+	return dir == "" || strings.HasPrefix(p, dir+"/")
+}
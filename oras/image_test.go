@@ -0,0 +1,92 @@
+package oras_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/zeitlos/knockknock/config"
+	"github.com/zeitlos/knockknock/knockknocktest"
+	"github.com/zeitlos/knockknock/oras"
+)
+
+func newClient(t *testing.T, reg *knockknocktest.Registry) *oras.Client {
+	t.Helper()
+
+	cfg := config.New("app").
+		WithRepo(reg.Repo("app")).
+		WithPlainHTTP().
+		WithVersion("1.0.0").
+		WithInstallationDir(t.TempDir())
+
+	client, err := oras.NewClient(cfg)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client
+}
+
+func download(t *testing.T, client *oras.Client, version string) []byte {
+	t.Helper()
+
+	dest := t.TempDir()
+
+	if err := client.Download(context.Background(), version, dest, nil); err != nil {
+		t.Fatalf("failed to download %s: %v", version, err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dest, "app"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+// `oras push <ref> app` without a media type uses the OCI tar layer media
+// type for the binary, which must not be mistaken for an image.
+func TestDownloadArtifactWithTarLayerType(t *testing.T) {
+	reg := knockknocktest.NewRegistry(t)
+	binary := []byte("#!/bin/sh\necho 1.1.0\n")
+
+	layer := reg.PushBlob("app", ocispec.MediaTypeImageLayer, binary)
+	layer.Annotations = map[string]string{ocispec.AnnotationTitle: "app"}
+
+	desc := reg.PushArtifact(t, "app", "1.1.0", []ocispec.Descriptor{layer}, nil)
+
+	client := newClient(t, reg)
+
+	dgst, err := client.Resolve(context.Background(), "1.1.0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dgst != desc.Digest {
+		t.Fatalf("resolved %s, expected %s", dgst, desc.Digest)
+	}
+
+	if got := download(t, client, "1.1.0"); !bytes.Equal(got, binary) {
+		t.Fatalf("unexpected binary %q", got)
+	}
+}
+
+func TestDownloadImage(t *testing.T) {
+	reg := knockknocktest.NewRegistry(t)
+	binary := []byte("#!/bin/sh\necho 2.0.0\n")
+
+	reg.PushImage(t, "app", "2.0.0", map[string][]byte{
+		"/usr/local/bin/app": binary,
+		"/etc/app.conf":      []byte("config"),
+	})
+
+	if got := download(t, newClient(t, reg), "2.0.0"); !bytes.Equal(got, binary) {
+		t.Fatalf("unexpected binary %q", got)
+	}
+}
@@ -0,0 +1,409 @@
+package oras
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/zeitlos/knockknock/config"
+)
+
+// entry is a tar entry of a test layer. Entries without a type are regular
+// files.
+type entry struct {
+	name     string
+	typeflag byte
+	content  string
+	linkname string
+}
+
+func file(name, content string) entry {
+	return entry{name: name, content: content}
+}
+
+func dir(name string) entry {
+	return entry{name: name, typeflag: tar.TypeDir}
+}
+
+func symlink(name, target string) entry {
+	return entry{name: name, typeflag: tar.TypeSymlink, linkname: target}
+}
+
+func hardlink(name, target string) entry {
+	return entry{name: name, typeflag: tar.TypeLink, linkname: target}
+}
+
+type compression int
+
+const (
+	uncompressed compression = iota
+	gzipped
+	zstdCompressed
+)
+
+// writeLayer writes entries as a tar layer into dir and returns its path.
+func writeLayer(t *testing.T, dir string, entries []entry, c compression) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	tw := tar.NewWriter(&buf)
+
+	for _, e := range entries {
+		hdr := &tar.Header{
+			Name:     e.name,
+			Typeflag: e.typeflag,
+			Linkname: e.linkname,
+			Mode:     0755,
+		}
+
+		if hdr.Typeflag == 0 {
+			hdr.Typeflag = tar.TypeReg
+			hdr.Size = int64(len(e.content))
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := tw.Write([]byte(e.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.Bytes()
+
+	switch c {
+	case gzipped:
+		var gz bytes.Buffer
+
+		w := gzip.NewWriter(&gz)
+		w.Write(data)
+		w.Close()
+
+		data = gz.Bytes()
+	case zstdCompressed:
+		w, err := zstd.NewWriter(nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data = w.EncodeAll(data, nil)
+		w.Close()
+	}
+
+	f, err := os.CreateTemp(dir, "layer")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+
+	return f.Name()
+}
+
+func TestExtractImage(t *testing.T) {
+	tests := []struct {
+		name    string
+		layers  [][]entry
+		want    string
+		wantErr string
+	}{
+		{
+			name:   "single layer",
+			layers: [][]entry{{dir("usr/"), dir("usr/local/bin/"), file("usr/local/bin/app", "v1")}},
+			want:   "v1",
+		},
+		{
+			name:   "dot slash names",
+			layers: [][]entry{{file("./usr/local/bin/app", "v1")}},
+			want:   "v1",
+		},
+		{
+			name: "upper layer replaces the file",
+			layers: [][]entry{
+				{file("usr/local/bin/app", "v1")},
+				{file("usr/local/bin/app", "v2")},
+			},
+			want: "v2",
+		},
+		{
+			name: "whiteout deletes the file",
+			layers: [][]entry{
+				{file("usr/local/bin/app", "v1")},
+				{file("usr/local/bin/.wh.app", "")},
+			},
+			wantErr: "not found",
+		},
+		{
+			name: "whiteout of a parent directory",
+			layers: [][]entry{
+				{file("usr/local/bin/app", "v1")},
+				{file("usr/local/.wh.bin", "")},
+			},
+			wantErr: "not found",
+		},
+		{
+			name: "whiteout of a sibling",
+			layers: [][]entry{
+				{file("usr/local/bin/app", "v1")},
+				{file("usr/local/bin/.wh.app-old", "")},
+			},
+			want: "v1",
+		},
+		{
+			name: "file added again after a whiteout",
+			layers: [][]entry{
+				{file("usr/local/bin/app", "v1")},
+				{file("usr/local/bin/.wh.app", "")},
+				{file("usr/local/bin/app", "v3")},
+			},
+			want: "v3",
+		},
+		{
+			name: "whiteout and new file in the same layer",
+			layers: [][]entry{
+				{file("usr/local/bin/app", "v1")},
+				{file("usr/local/bin/.wh.app", ""), file("usr/local/bin/app", "v2")},
+			},
+			want: "v2",
+		},
+		{
+			name: "opaque directory hides lower layers",
+			layers: [][]entry{
+				{file("usr/local/bin/app", "v1")},
+				{dir("usr/local/bin/"), file("usr/local/bin/.wh..wh..opq", "")},
+			},
+			wantErr: "not found",
+		},
+		{
+			name: "opaque parent directory",
+			layers: [][]entry{
+				{file("usr/local/bin/app", "v1")},
+				{file("usr/.wh..wh..opq", "")},
+			},
+			wantErr: "not found",
+		},
+		{
+			name: "opaque directory keeps its own layer",
+			layers: [][]entry{
+				{file("usr/local/bin/app", "v1")},
+				{file("usr/local/bin/.wh..wh..opq", ""), file("usr/local/bin/app", "v2")},
+			},
+			want: "v2",
+		},
+		{
+			name: "opaque sibling directory",
+			layers: [][]entry{
+				{file("usr/local/bin/app", "v1")},
+				{file("usr/local/lib/.wh..wh..opq", "")},
+			},
+			want: "v1",
+		},
+		{
+			name:   "relative symlink",
+			layers: [][]entry{{symlink("usr/local/bin/app", "../lib/app/app"), file("usr/local/lib/app/app", "v1")}},
+			want:   "v1",
+		},
+		{
+			name: "absolute symlink across layers",
+			layers: [][]entry{
+				{file("opt/app/app", "v1")},
+				{symlink("usr/local/bin/app", "/opt/app/app")},
+			},
+			want: "v1",
+		},
+		{
+			name: "symlink chain",
+			layers: [][]entry{{
+				symlink("usr/local/bin/app", "app-1.0"),
+				symlink("usr/local/bin/app-1.0", "/opt/app/current"),
+				symlink("opt/app/current", "releases/1.0/app"),
+				file("opt/app/releases/1.0/app", "v1"),
+			}},
+			want: "v1",
+		},
+		{
+			name:   "symlinked parent directory",
+			layers: [][]entry{{symlink("usr/local/bin", "/opt/bin"), file("opt/bin/app", "v1")}},
+			want:   "v1",
+		},
+		{
+			// Links are resolved inside the image, never on the host
+			name:   "symlink escaping the root",
+			layers: [][]entry{{symlink("usr/local/bin/app", "../../../../../../opt/app"), file("opt/app", "v1")}},
+			want:   "v1",
+		},
+		{
+			name:    "symlink escaping to a missing file",
+			layers:  [][]entry{{symlink("usr/local/bin/app", "../../../../../etc/hostname")}},
+			wantErr: "/etc/hostname not found",
+		},
+		{
+			name:    "dangling symlink",
+			layers:  [][]entry{{symlink("usr/local/bin/app", "missing")}},
+			wantErr: "not found",
+		},
+		{
+			name:    "symlink loop",
+			layers:  [][]entry{{symlink("usr/local/bin/app", "app2"), symlink("usr/local/bin/app2", "app")}},
+			wantErr: "too many links",
+		},
+		{
+			name: "whiteout of the symlink target",
+			layers: [][]entry{
+				{symlink("usr/local/bin/app", "/opt/app"), file("opt/app", "v1")},
+				{file("opt/.wh.app", "")},
+			},
+			wantErr: "/opt/app not found",
+		},
+		{
+			name:   "hardlink",
+			layers: [][]entry{{file("opt/app/app", "v1"), hardlink("usr/local/bin/app", "opt/app/app")}},
+			want:   "v1",
+		},
+		{
+			name:   "hardlink with absolute name",
+			layers: [][]entry{{file("opt/app/app", "v1"), hardlink("usr/local/bin/app", "/opt/app/app")}},
+			want:   "v1",
+		},
+		{
+			name:   "hardlink escaping the root",
+			layers: [][]entry{{file("opt/app/app", "v1"), hardlink("usr/local/bin/app", "../../../opt/app/app")}},
+			want:   "v1",
+		},
+		{
+			name: "hardlink to a lower layer",
+			layers: [][]entry{
+				{file("opt/app/app", "v1")},
+				{hardlink("usr/local/bin/app", "opt/app/app")},
+			},
+			want: "v1",
+		},
+		{
+			// The link keeps the file it was created for
+			name: "hardlink to a file replaced later",
+			layers: [][]entry{
+				{file("opt/app/app", "v1"), hardlink("usr/local/bin/app", "opt/app/app")},
+				{file("opt/app/app", "v2")},
+			},
+			want: "v1",
+		},
+		{
+			name:    "hardlink to a missing file",
+			layers:  [][]entry{{hardlink("usr/local/bin/app", "opt/app/app")}},
+			wantErr: "/opt/app/app not found",
+		},
+		{
+			name:    "directory",
+			layers:  [][]entry{{dir("usr/local/bin/app/")}},
+			wantErr: "not a regular file",
+		},
+		{
+			name:    "file as parent directory",
+			layers:  [][]entry{{file("usr/local/bin", "not a directory")}},
+			wantErr: "not a regular file",
+		},
+	}
+
+	for _, tt := range tests {
+		for _, c := range []compression{uncompressed, gzipped, zstdCompressed} {
+			name := tt.name + []string{"", "/gzip", "/zstd"}[c]
+
+			t.Run(name, func(t *testing.T) {
+				dir := t.TempDir()
+
+				var layers []string
+
+				for _, entries := range tt.layers {
+					layers = append(layers, writeLayer(t, dir, entries, c))
+				}
+
+				client := &Client{config: config.New("app")}
+				dest := t.TempDir()
+
+				err := client.extractImage(layers, dest)
+
+				if tt.wantErr != "" {
+					if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+						t.Fatalf("expected an error containing %q, got %v", tt.wantErr, err)
+					}
+
+					if entries, _ := os.ReadDir(dest); len(entries) != 0 {
+						t.Fatalf("expected nothing to be extracted, got %d entries", len(entries))
+					}
+
+					return
+				}
+
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				data, err := os.ReadFile(filepath.Join(dest, "app"))
+
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if string(data) != tt.want {
+					t.Fatalf("extracted %q, expected %q", data, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestExtractImageCustomPath(t *testing.T) {
+	layer := writeLayer(t, t.TempDir(), []entry{file("app/bin/server", "v1")}, uncompressed)
+
+	client := &Client{config: config.New("server").WithImagePath("app/bin/server/")}
+	dest := t.TempDir()
+
+	if err := client.extractImage([]string{layer}, dest); err != nil {
+		t.Fatal(err)
+	}
+
+	if data, _ := os.ReadFile(filepath.Join(dest, "server")); string(data) != "v1" {
+		t.Fatalf("extracted %q", data)
+	}
+}
+
+func TestWalkLayerCorrupt(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := map[string][]byte{
+		"gzip": append([]byte{0x1f, 0x8b}, bytes.Repeat([]byte{0}, 20)...),
+		"zstd": append([]byte{0x28, 0xb5, 0x2f, 0xfd}, bytes.Repeat([]byte{0xff}, 20)...),
+		"tar":  bytes.Repeat([]byte("x"), 600),
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			layer := filepath.Join(dir, name)
+
+			if err := os.WriteFile(layer, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := walkLayer(layer, func(*tar.Header, io.Reader) error { return nil }); err == nil {
+				t.Fatal("expected a corrupt layer to fail")
+			}
+		})
+	}
+}
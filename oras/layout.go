@@ -0,0 +1,37 @@
+package oras
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/zeitlos/knockknock/config"
+
+	"oras.land/oras-go/v2/content/oci"
+)
+
+// NewLayoutClient creates a client that reads versions from an OCI image
+// layout, either a directory or a tar archive of one, instead of a registry.
+// The layout's tags are its versions.
+func NewLayoutClient(ctx context.Context, config *config.Config, path string) (*Client, error) {
+	info, err := os.Stat(path)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to open layout: %w", err)
+	}
+
+	var store *oci.ReadOnlyStore
+
+	if info.IsDir() {
+		store, err = oci.NewFromFS(ctx, os.DirFS(path))
+	} else {
+		store, err = oci.NewFromTar(ctx, path)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid layout %s: %w", filepath.Base(path), err)
+	}
+
+	return newClient(config, store)
+}
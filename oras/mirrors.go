@@ -0,0 +1,414 @@
+package oras
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/zeitlos/knockknock/config"
+	"github.com/zeitlos/knockknock/source"
+
+	"oras.land/oras-go/v2/registry/remote"
+)
+
+// ErrDigestMismatch is returned when the repository and its mirrors serve
+// different content under the same tag.
+var ErrDigestMismatch = errors.New("mirrors disagree on digest")
+
+const (
+	// latencyProbeInterval is how long measured round-trip times are used
+	// before the repositories are probed again.
+	latencyProbeInterval = 5 * time.Minute
+	latencyProbeTimeout  = 5 * time.Second
+)
+
+var (
+	_ source.UpdateSource      = (*Mirrors)(nil)
+	_ source.ConditionalSource = (*Mirrors)(nil)
+	_ source.TransferCounter   = (*Mirrors)(nil)
+)
+
+// Mirrors is an update source backed by a repository and its mirrors. Calls
+// go to the first repository that answers, in the order of the mirror
+// strategy. Before a download, the version is resolved on every reachable
+// repository and refused unless all of them agree on its digest.
+type Mirrors struct {
+	endpoints []endpoint
+	strategy  config.MirrorStrategy
+
+	mu        sync.Mutex
+	latencies map[string]time.Duration
+	probedAt  time.Time
+}
+
+type endpoint struct {
+	repo   string
+	client *Client
+}
+
+// NewSource returns the registry update source for config: a Client for
+// config.Repo, or Mirrors if mirrors are configured.
+func NewSource(config *config.Config) (source.UpdateSource, error) {
+	if len(config.Mirrors) == 0 {
+		return NewClient(config)
+	}
+
+	return NewMirrors(config)
+}
+
+// NewMirrors returns a source for cfg.Repo and each of cfg.Mirrors.
+func NewMirrors(cfg *config.Config) (*Mirrors, error) {
+	switch cfg.MirrorStrategy {
+	case "", config.MirrorOrdered, config.MirrorLatency:
+	default:
+		return nil, fmt.Errorf("invalid mirror strategy '%s'", cfg.MirrorStrategy)
+	}
+
+	primary, err := NewClient(cfg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Mirrors{
+		endpoints: []endpoint{{repo: cfg.Repo, client: primary}},
+		strategy:  cfg.MirrorStrategy,
+	}
+
+	for _, mirror := range cfg.Mirrors {
+		tlsConfig := mirror.TLS
+
+		if tlsConfig == nil {
+			tlsConfig = cfg.TLS
+		}
+
+		repo, err := newRepository(mirror.Repo, mirror.Auth, tlsConfig, mirror.PlainHTTP, cfg.Proxy)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid mirror %s: %w", mirror.Repo, err)
+		}
+
+		client, err := newClient(cfg, repo)
+
+		if err != nil {
+			return nil, err
+		}
+
+		m.endpoints = append(m.endpoints, endpoint{repo: mirror.Repo, client: client})
+	}
+
+	return m, nil
+}
+
+func (m *Mirrors) Versions(ctx context.Context) ([]semver.Version, error) {
+	var versions []semver.Version
+
+	err := m.try(ctx, func(e endpoint) error {
+		var err error
+		versions, err = e.client.Versions(ctx)
+
+		return err
+	})
+
+	return versions, err
+}
+
+// VersionsIfChanged lists the first repository that answers. The ETag is
+// prefixed with the repository, since it only means something to the one
+// that sent it.
+func (m *Mirrors) VersionsIfChanged(ctx context.Context, etag string) ([]semver.Version, string, error) {
+	var versions []semver.Version
+	var newTag string
+	var notModified bool
+
+	err := m.try(ctx, func(e endpoint) error {
+		previous := ""
+
+		if repo, tag, ok := strings.Cut(etag, " "); ok && repo == e.repo {
+			previous = tag
+		}
+
+		var err error
+		versions, newTag, err = e.client.VersionsIfChanged(ctx, previous)
+
+		if errors.Is(err, source.ErrNotModified) {
+			notModified = true
+			return nil
+		}
+
+		if newTag != "" {
+			newTag = e.repo + " " + newTag
+		}
+
+		return err
+	})
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	if notModified {
+		return nil, etag, source.ErrNotModified
+	}
+
+	return versions, newTag, nil
+}
+
+// Resolve returns the digest of version all reachable repositories agree on.
+func (m *Mirrors) Resolve(ctx context.Context, version string) (digest.Digest, error) {
+	_, dgst, err := m.resolveAll(ctx, version)
+
+	return dgst, err
+}
+
+func (m *Mirrors) Download(ctx context.Context, version, destDir string, progress ProgressFunc) error {
+	descs, _, err := m.resolveAll(ctx, version)
+
+	if err != nil {
+		return err
+	}
+
+	// Each repository downloads the manifest it resolved itself, which was
+	// checked against the others, and the content is verified against it
+	return m.try(ctx, func(e endpoint) error {
+		desc, ok := descs[e.repo]
+
+		if !ok {
+			return fmt.Errorf("version %s not available", version)
+		}
+
+		return e.client.download(ctx, desc, version, destDir, progress)
+	})
+}
+
+// Metadata describes version once all reachable repositories agree on its
+// digest, since e.g. Critical and MinSupervisorVersion decide whether to
+// update.
+func (m *Mirrors) Metadata(ctx context.Context, version string) (*source.Metadata, error) {
+	descs, dgst, err := m.resolveAll(ctx, version)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata *source.Metadata
+
+	err = m.try(ctx, func(e endpoint) error {
+		desc, ok := descs[e.repo]
+
+		if !ok {
+			return fmt.Errorf("version %s not available", version)
+		}
+
+		var err error
+		metadata, err = e.client.metadata(ctx, desc, version)
+
+		if err != nil {
+			return err
+		}
+
+		if metadata.Digest != dgst {
+			return fmt.Errorf("%w for %s: %s=%s, expected %s", ErrDigestMismatch, version, e.repo, metadata.Digest, dgst)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return metadata, nil
+}
+
+func (m *Mirrors) CountTransfers(fn func(n int64)) {
+	for _, e := range m.endpoints {
+		e.client.CountTransfers(fn)
+	}
+}
+
+// resolveAll resolves version on every repository and returns the manifests
+// found by repository, after checking they all have the same digest.
+func (m *Mirrors) resolveAll(ctx context.Context, version string) (map[string]ocispec.Descriptor, digest.Digest, error) {
+	descs := map[string]ocispec.Descriptor{}
+	errs := make([]error, len(m.endpoints))
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for i, e := range m.endpoints {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			desc, err := e.client.resolveManifest(ctx, version)
+
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", e.repo, err)
+				return
+			}
+
+			mu.Lock()
+			descs[e.repo] = desc
+			mu.Unlock()
+		}()
+	}
+
+	wg.Wait()
+
+	if len(descs) == 0 {
+		return nil, "", errors.Join(errs...)
+	}
+
+	var dgst digest.Digest
+	var seen []string
+	mismatch := false
+
+	for _, e := range m.endpoints {
+		desc, ok := descs[e.repo]
+
+		if !ok {
+			continue
+		}
+
+		if dgst == "" {
+			dgst = desc.Digest
+		}
+
+		if desc.Digest != dgst {
+			mismatch = true
+		}
+
+		seen = append(seen, fmt.Sprintf("%s=%s", e.repo, desc.Digest))
+	}
+
+	if mismatch {
+		slog.Error("mirrors serve different content", "version", version, "digests", seen)
+
+		return nil, "", fmt.Errorf("%w for %s: %s", ErrDigestMismatch, version, strings.Join(seen, ", "))
+	}
+
+	return descs, dgst, nil
+}
+
+// try calls fn for each repository in order until it succeeds, and returns
+// all errors if none did.
+func (m *Mirrors) try(ctx context.Context, fn func(e endpoint) error) error {
+	var errs []error
+
+	for _, e := range m.ordered(ctx) {
+		err := fn(e)
+
+		if err == nil {
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			return err
+		}
+
+		slog.Warn("repository failed, trying next mirror", "repo", e.repo, "error", err)
+		errs = append(errs, fmt.Errorf("%s: %w", e.repo, err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// ordered returns the repositories in the order they should be tried.
+func (m *Mirrors) ordered(ctx context.Context) []endpoint {
+	if m.strategy != config.MirrorLatency {
+		return m.endpoints
+	}
+
+	latencies := m.measure(ctx)
+
+	endpoints := slices.Clone(m.endpoints)
+
+	// Stable, so equally fast or unreachable repositories keep their order
+	slices.SortStableFunc(endpoints, func(a, b endpoint) int {
+		return int(latencies[a.repo] - latencies[b.repo])
+	})
+
+	return endpoints
+}
+
+// measure returns the round-trip time to each repository's registry,
+// probing them again once the last measurement is too old. Unreachable
+// registries get the probe timeout.
+func (m *Mirrors) measure(ctx context.Context) map[string]time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.latencies != nil && time.Since(m.probedAt) < latencyProbeInterval {
+		return m.latencies
+	}
+
+	latencies := map[string]time.Duration{}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, e := range m.endpoints {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			latency := probe(ctx, e.client)
+
+			mu.Lock()
+			latencies[e.repo] = latency
+			mu.Unlock()
+		}()
+	}
+
+	wg.Wait()
+
+	slog.Debug("measured mirror latencies", "latencies", latencies)
+
+	m.latencies = latencies
+	m.probedAt = time.Now()
+
+	return latencies
+}
+
+// probe times a request to the registry's API root. Any HTTP response
+// counts, since the registry may require authentication for it.
+func probe(ctx context.Context, client *Client) time.Duration {
+	repo, ok := client.oras.(*remote.Repository)
+
+	if !ok {
+		return 0
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, latencyProbeTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL(repo), nil)
+
+	if err != nil {
+		return latencyProbeTimeout
+	}
+
+	start := time.Now()
+
+	resp, err := repo.Client.Do(req)
+
+	if err != nil {
+		return latencyProbeTimeout
+	}
+
+	resp.Body.Close()
+
+	return time.Since(start)
+}
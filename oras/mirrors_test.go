@@ -0,0 +1,139 @@
+package oras_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/zeitlos/knockknock/config"
+	"github.com/zeitlos/knockknock/knockknocktest"
+	"github.com/zeitlos/knockknock/oras"
+	"github.com/zeitlos/knockknock/source"
+)
+
+func newMirrors(t *testing.T, primary, mirror *knockknocktest.Registry) *oras.Mirrors {
+	t.Helper()
+
+	cfg := config.New("app").
+		WithRepo(primary.Repo("app")).
+		WithPlainHTTP().
+		WithVersion("1.0.0").
+		WithInstallationDir(t.TempDir()).
+		WithMirror(config.Mirror{Repo: mirror.Repo("app"), PlainHTTP: true})
+
+	m, err := oras.NewMirrors(cfg)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return m
+}
+
+func pushRelease(t *testing.T, reg *knockknocktest.Registry, binary []byte, annotations map[string]string) ocispec.Descriptor {
+	t.Helper()
+
+	layer := reg.PushBlob("app", knockknocktest.BinaryMediaType, binary)
+	layer.Annotations = map[string]string{ocispec.AnnotationTitle: "app"}
+
+	return reg.PushArtifact(t, "app", "1.1.0", []ocispec.Descriptor{layer}, annotations)
+}
+
+func TestMirrorsAgree(t *testing.T) {
+	primary := knockknocktest.NewRegistry(t)
+	mirror := knockknocktest.NewRegistry(t)
+	binary := []byte("#!/bin/sh\necho 1.1.0\n")
+
+	annotations := map[string]string{source.AnnotationCritical: "true"}
+
+	desc := pushRelease(t, primary, binary, annotations)
+	pushRelease(t, mirror, binary, annotations)
+
+	m := newMirrors(t, primary, mirror)
+
+	metadata, err := m.Metadata(context.Background(), "1.1.0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if metadata.Digest != desc.Digest || !metadata.Critical {
+		t.Fatalf("unexpected metadata %+v", metadata)
+	}
+
+	dest := t.TempDir()
+
+	if err := m.Download(context.Background(), "1.1.0", dest, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := os.ReadFile(filepath.Join(dest, "app")); !bytes.Equal(got, binary) {
+		t.Fatalf("unexpected binary %q", got)
+	}
+}
+
+func TestMirrorsDisagree(t *testing.T) {
+	binary := []byte("#!/bin/sh\necho 1.1.0\n")
+
+	tests := []struct {
+		name           string
+		primary        []byte
+		mirror         []byte
+		mirrorMetadata map[string]string
+	}{
+		{
+			name:    "different binary",
+			primary: binary,
+			mirror:  []byte("#!/bin/sh\necho rogue\n"),
+		},
+		{
+			// Same binary, but the mirror forces the update
+			name:           "different annotations",
+			primary:        binary,
+			mirror:         binary,
+			mirrorMetadata: map[string]string{source.AnnotationCritical: "true"},
+		},
+		{
+			// Same binary, but the mirror blocks the update
+			name:           "different minimum version",
+			primary:        binary,
+			mirror:         binary,
+			mirrorMetadata: map[string]string{source.AnnotationMinSupervisorVersion: "9.0.0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary := knockknocktest.NewRegistry(t)
+			mirror := knockknocktest.NewRegistry(t)
+
+			pushRelease(t, primary, tt.primary, nil)
+			pushRelease(t, mirror, tt.mirror, tt.mirrorMetadata)
+
+			m := newMirrors(t, primary, mirror)
+			ctx := context.Background()
+
+			if _, err := m.Resolve(ctx, "1.1.0"); !errors.Is(err, oras.ErrDigestMismatch) {
+				t.Errorf("Resolve: expected ErrDigestMismatch, got %v", err)
+			}
+
+			if _, err := m.Metadata(ctx, "1.1.0"); !errors.Is(err, oras.ErrDigestMismatch) {
+				t.Errorf("Metadata: expected ErrDigestMismatch, got %v", err)
+			}
+
+			dest := t.TempDir()
+
+			if err := m.Download(ctx, "1.1.0", dest, nil); !errors.Is(err, oras.ErrDigestMismatch) {
+				t.Errorf("Download: expected ErrDigestMismatch, got %v", err)
+			}
+
+			if entries, _ := os.ReadDir(dest); len(entries) != 0 {
+				t.Errorf("expected nothing to be downloaded, got %d entries", len(entries))
+			}
+		})
+	}
+}
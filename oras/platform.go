@@ -0,0 +1,123 @@
+package oras
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// mediaTypeDockerManifestList is the Docker equivalent of an OCI image index.
+const mediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+
+// ErrNoMatchingPlatform is returned when an image index has no manifest for
+// the platform the supervisor runs on.
+var ErrNoMatchingPlatform = errors.New("no manifest matches the platform")
+
+// ParsePlatform parses a platform in the os/arch[/variant] notation used by
+// docker, e.g. "linux/arm/v7".
+func ParsePlatform(s string) (ocispec.Platform, error) {
+	parts := strings.Split(s, "/")
+
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return ocispec.Platform{}, fmt.Errorf("invalid platform '%s', expected os/arch[/variant]", s)
+	}
+
+	platform := ocispec.Platform{
+		OS:           parts[0],
+		Architecture: parts[1],
+	}
+
+	if len(parts) == 3 {
+		platform.Variant = parts[2]
+	}
+
+	return platform, nil
+}
+
+// currentPlatform returns the platform the binary was built for. The arm
+// variant is taken from GOARM, which is only known from the build info.
+func currentPlatform() ocispec.Platform {
+	platform := ocispec.Platform{
+		OS:           runtime.GOOS,
+		Architecture: runtime.GOARCH,
+	}
+
+	if runtime.GOARCH == "arm" {
+		if info, ok := debug.ReadBuildInfo(); ok {
+			for _, setting := range info.Settings {
+				if setting.Key == "GOARM" {
+					// GOARM may carry a float ABI suffix, e.g. "7,softfloat"
+					version, _, _ := strings.Cut(setting.Value, ",")
+					platform.Variant = "v" + version
+				}
+			}
+		}
+	}
+
+	return platform
+}
+
+func formatPlatform(p ocispec.Platform) string {
+	s := p.OS + "/" + p.Architecture
+
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+
+	return s
+}
+
+func isIndex(mediaType string) bool {
+	return mediaType == ocispec.MediaTypeImageIndex || mediaType == mediaTypeDockerManifestList
+}
+
+// selectManifest picks the manifest for platform from an index. A manifest
+// with the exact variant wins over one without a variant. When no variant is
+// wanted, the first manifest for the OS and architecture is taken.
+func selectManifest(index ocispec.Index, platform ocispec.Platform) (ocispec.Descriptor, error) {
+	var generic *ocispec.Descriptor
+	var available []string
+
+	for i, m := range index.Manifests {
+		if m.Platform == nil {
+			continue
+		}
+
+		available = append(available, formatPlatform(*m.Platform))
+
+		if m.Platform.OS != platform.OS || m.Platform.Architecture != platform.Architecture {
+			continue
+		}
+
+		if normalizeVariant(*m.Platform) == normalizeVariant(platform) {
+			return m, nil
+		}
+
+		if generic == nil && (m.Platform.Variant == "" || platform.Variant == "") {
+			generic = &index.Manifests[i]
+		}
+	}
+
+	if generic != nil {
+		return *generic, nil
+	}
+
+	return ocispec.Descriptor{}, fmt.Errorf("%w %s, available: %s", ErrNoMatchingPlatform, formatPlatform(platform), strings.Join(available, ", "))
+}
+
+// normalizeVariant treats the default variants of arm64 and amd64 like no
+// variant.
+func normalizeVariant(p ocispec.Platform) string {
+	switch {
+	case p.Architecture == "arm64" && p.Variant == "v8":
+		return ""
+	case p.Architecture == "amd64" && p.Variant == "v1":
+		return ""
+	default:
+		return p.Variant
+	}
+}
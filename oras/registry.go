@@ -2,57 +2,83 @@ package oras
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
-	"slices"
+	"sort"
 
 	"github.com/zeitlos/knockknock/config"
+	"github.com/zeitlos/knockknock/source"
 
 	"github.com/Masterminds/semver/v3"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"oras.land/oras-go/v2"
-	"oras.land/oras-go/v2/content/file"
-	"oras.land/oras-go/v2/registry/remote"
-	"oras.land/oras-go/v2/registry/remote/auth"
-	"oras.land/oras-go/v2/registry/remote/credentials"
-	"oras.land/oras-go/v2/registry/remote/retry"
+	"oras.land/oras-go/v2/content"
+	"oras.land/oras-go/v2/registry"
 )
 
+// ProgressFunc reports how many bytes of an update have been downloaded.
+type ProgressFunc = source.ProgressFunc
+
+var _ source.UpdateSource = (*Client)(nil)
+
+// target is where a Client pulls versions from: a remote repository or an
+// OCI image layout.
+type target interface {
+	oras.ReadOnlyTarget
+	registry.TagLister
+}
+
 type Client struct {
-	oras           *remote.Repository
+	oras           target
 	currentVersion *semver.Version
+	platform       ocispec.Platform
+	cache          blobCache
+	limiter        *rateLimiter
+	transferred    func(n int64)
 
 	config *config.Config
 }
 
 func NewClient(config *config.Config) (*Client, error) {
-	repo, err := remote.NewRepository(config.Repo)
-
-	if err != nil {
-		return nil, fmt.Errorf("invalid repository: %w", err)
-	}
-
-	store, err := credentials.NewStoreFromDocker(credentials.StoreOptions{})
+	repo, err := newRepository(config.Repo, config.Auth, config.TLS, config.PlainHTTP, config.Proxy)
 
 	if err != nil {
 		return nil, err
 	}
 
-	repo.Client = &auth.Client{
-		Client:     retry.DefaultClient,
-		Cache:      auth.NewCache(),
-		Credential: credentials.Credential(store),
-	}
+	return newClient(config, repo)
+}
 
+func newClient(config *config.Config, target target) (*Client, error) {
 	currentVersion, err := semver.NewVersion(config.Version)
 
 	if err != nil {
 		return nil, fmt.Errorf("invalid current version '%s': %w", config.Version, err)
 	}
 
+	platform := currentPlatform()
+
+	if config.Platform != "" {
+		platform, err = ParsePlatform(config.Platform)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &Client{
-		oras:           repo,
+		oras:           target,
 		currentVersion: currentVersion,
+		platform:       platform,
+		cache: blobCache{
+			dir:     filepath.Join(config.InstallationDir, config.BinaryName, "cache", "blobs"),
+			maxSize: config.DownloadCacheSize,
+		},
+		limiter: newRateLimiter(config.DownloadRateLimit),
 
 		config: config,
 	}, nil
@@ -71,6 +97,11 @@ func (r *Client) Versions(ctx context.Context) ([]semver.Version, error) {
 		return nil, fmt.Errorf("failed to list tags: %w", err)
 	}
 
+	return parseTags(tags), nil
+}
+
+// parseTags returns the semver tags as versions in ascending order.
+func parseTags(tags []string) []semver.Version {
 	var versions []semver.Version
 	for _, tag := range tags {
 		v, err := semver.NewVersion(tag)
@@ -83,7 +114,11 @@ func (r *Client) Versions(ctx context.Context) ([]semver.Version, error) {
 		versions = append(versions, *v)
 	}
 
-	return versions, nil
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].LessThan(&versions[j])
+	})
+
+	return versions
 }
 
 func (r *Client) CheckForUpdate(ctx context.Context) (update *semver.Version, allVersions []semver.Version, err error) {
@@ -110,41 +145,224 @@ func (r *Client) CheckForUpdate(ctx context.Context) (update *semver.Version, al
 	return
 }
 
-func (r *Client) DownloadUpdate(ctx context.Context, version, destDir string) error {
+func (r *Client) Download(ctx context.Context, version, destDir string, progress ProgressFunc) error {
+	desc, err := r.resolveManifest(ctx, version)
+
+	if err != nil {
+		return err
+	}
+
+	return r.download(ctx, desc, version, destDir, progress)
+}
+
+// download pulls the manifest desc, which version resolved to, into destDir.
+// Layers are fetched through the download cache, and titled layers are
+// written to destDir like `oras pull` does.
+func (r *Client) download(ctx context.Context, desc ocispec.Descriptor, version, destDir string, progress ProgressFunc) error {
 	if err := os.MkdirAll(destDir, 0755); err != nil {
 		return fmt.Errorf("failed to create destination dir: %w", err)
 	}
 
-	fs, err := file.New(destDir)
+	manifest, err := r.fetchManifest(ctx, desc)
+
 	if err != nil {
-		return fmt.Errorf("failed to create fs store: %w", err)
+		return err
 	}
-	defer fs.Close()
 
-	if _, err := oras.Copy(ctx, r.oras, version, fs, version, oras.DefaultCopyOptions); err != nil {
-		return fmt.Errorf("failed to download version %s: %w", version, err)
+	if isImage(manifest) {
+		if err := checkImageLayers(manifest); err != nil {
+			return fmt.Errorf("failed to download version %s: %w", version, err)
+		}
 	}
 
-	entries, err := os.ReadDir(destDir)
+	layers, err := r.fetchLayers(ctx, manifest, progress)
+
 	if err != nil {
-		return fmt.Errorf("failed to read destination directory: %w", err)
+		return fmt.Errorf("failed to download version %s: %w", version, err)
 	}
 
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
+	defer func() {
+		if err := r.cache.prune(); err != nil {
+			slog.Warn("failed to prune download cache", "error", err)
+		}
+	}()
+
+	if isImage(manifest) {
+		if err := r.extractImage(layers, destDir); err != nil {
+			return fmt.Errorf("failed to extract version %s from image: %w", version, err)
 		}
 
-		if entry.Name() != r.config.BinaryName {
+		return nil
+	}
+
+	for i, layer := range manifest.Layers {
+		name := layer.Annotations[ocispec.AnnotationTitle]
+
+		if name == "" {
 			continue
 		}
 
-		binaryPath := filepath.Join(destDir, entry.Name())
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("invalid file name '%s' in version %s", name, version)
+		}
+
+		if layer.Annotations[annotationUnpack] == "true" {
+			return fmt.Errorf("directory '%s' in version %s is not supported", name, version)
+		}
+
+		mode := os.FileMode(0644)
 
-		if err := os.Chmod(binaryPath, 0755); err != nil {
-			return fmt.Errorf("failed to chmod %s: %w", entry.Name(), err)
+		if name == r.config.BinaryName {
+			mode = 0755
+		}
+
+		if err := copyFile(layers[i], filepath.Join(destDir, name), mode); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
+
+// fetchLayers returns the paths of the manifest's layers in the download
+// cache, reporting progress across all of them.
+func (r *Client) fetchLayers(ctx context.Context, manifest ocispec.Manifest, progress ProgressFunc) ([]string, error) {
+	var total, completed, reported int64
+
+	for _, layer := range manifest.Layers {
+		total += layer.Size
+	}
+
+	// Report at most once per percent
+	report := func(done int64) {
+		if progress == nil {
+			return
+		}
+
+		if done-reported >= total/100 || done == total {
+			reported = done
+			progress(done, total)
+		}
+	}
+
+	layers := make([]string, len(manifest.Layers))
+
+	for i, layer := range manifest.Layers {
+		path, err := r.fetchBlob(ctx, layer, func(done int64) {
+			report(completed + done)
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		layers[i] = path
+		completed += layer.Size
+	}
+
+	return layers, nil
+}
+
+// Resolve returns the digest of the manifest used for version, after
+// platform selection for multi-arch releases.
+func (r *Client) Resolve(ctx context.Context, version string) (digest.Digest, error) {
+	desc, err := r.resolveManifest(ctx, version)
+
+	if err != nil {
+		return "", err
+	}
+
+	return desc.Digest, nil
+}
+
+func (r *Client) Metadata(ctx context.Context, version string) (*source.Metadata, error) {
+	desc, err := r.resolveManifest(ctx, version)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return r.metadata(ctx, desc, version)
+}
+
+// metadata describes version from its resolved manifest desc.
+func (r *Client) metadata(ctx context.Context, desc ocispec.Descriptor, version string) (*source.Metadata, error) {
+	manifest, err := r.fetchManifest(ctx, desc)
+
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := &source.Metadata{
+		Version: version,
+		Digest:  desc.Digest,
+		Size:    artifactSize(desc, manifest),
+	}
+
+	metadata.SetAnnotations(manifest.Annotations)
+
+	return metadata, nil
+}
+
+// resolveManifest returns the manifest tagged with version. If the tag points to an
+// image index, the manifest for the client's platform is selected from it.
+func (r *Client) resolveManifest(ctx context.Context, version string) (ocispec.Descriptor, error) {
+	desc, err := r.oras.Resolve(ctx, version)
+
+	if err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("failed to resolve version %s: %w", version, err)
+	}
+
+	if !isIndex(desc.MediaType) {
+		return desc, nil
+	}
+
+	indexBytes, err := content.FetchAll(ctx, r.oras, desc)
+
+	if err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("failed to fetch index for %s: %w", version, err)
+	}
+
+	var index ocispec.Index
+
+	if err := json.Unmarshal(indexBytes, &index); err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("failed to parse index for %s: %w", version, err)
+	}
+
+	manifest, err := selectManifest(index, r.platform)
+
+	if err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("failed to select manifest for %s: %w", version, err)
+	}
+
+	return manifest, nil
+}
+
+// fetchManifest fetches and parses the manifest desc points to.
+func (r *Client) fetchManifest(ctx context.Context, desc ocispec.Descriptor) (ocispec.Manifest, error) {
+	var manifest ocispec.Manifest
+
+	manifestBytes, err := content.FetchAll(ctx, r.oras, desc)
+
+	if err != nil {
+		return manifest, fmt.Errorf("failed to fetch manifest %s: %w", desc.Digest, err)
+	}
+
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return manifest, fmt.Errorf("failed to parse manifest %s: %w", desc.Digest, err)
+	}
+
+	return manifest, nil
+}
+
+// artifactSize returns the combined size of the manifest, config and layers
+// of an artifact.
+func artifactSize(desc ocispec.Descriptor, manifest ocispec.Manifest) int64 {
+	total := desc.Size + manifest.Config.Size
+
+	for _, layer := range manifest.Layers {
+		total += layer.Size
+	}
+
+	return total
+}
@@ -0,0 +1,125 @@
+package oras
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/zeitlos/knockknock/source"
+
+	"oras.land/oras-go/v2/registry/remote"
+	"oras.land/oras-go/v2/registry/remote/auth"
+)
+
+var _ source.ConditionalSource = (*Client)(nil)
+
+// VersionsIfChanged lists the tags with If-None-Match, so registries that
+// send an ETag with the tag list can answer with 304 Not Modified. Layouts
+// are listed unconditionally.
+func (r *Client) VersionsIfChanged(ctx context.Context, etag string) ([]semver.Version, string, error) {
+	repo, ok := r.oras.(*remote.Repository)
+
+	if !ok {
+		versions, err := r.Versions(ctx)
+		return versions, "", err
+	}
+
+	ctx = auth.AppendRepositoryScope(ctx, repo.Reference, auth.ActionPull)
+
+	next := fmt.Sprintf("%s%s/tags/list", baseURL(repo), repo.Reference.Repository)
+
+	var tags []string
+	var listingTag string
+
+	// Only the first page is conditional, the rest follow its Link headers
+	for first := true; next != ""; first = false {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, next, nil)
+
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to create request: %w", err)
+		}
+
+		if first && etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+
+		page, resp, err := fetchTagPage(repo, req)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		if first {
+			if resp.StatusCode == http.StatusNotModified {
+				return nil, etag, source.ErrNotModified
+			}
+
+			listingTag = resp.Header.Get("ETag")
+		}
+
+		tags = append(tags, page...)
+
+		next, err = nextLink(resp)
+
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	return parseTags(tags), listingTag, nil
+}
+
+func fetchTagPage(repo *remote.Repository, req *http.Request) ([]string, *http.Response, error) {
+	resp, err := repo.Client.Do(req)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list tags: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, resp, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("failed to list tags: %s", resp.Status)
+	}
+
+	var page struct {
+		Tags []string `json:"tags"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse tag list: %w", err)
+	}
+
+	return page.Tags, resp, nil
+}
+
+// nextLink returns the URL of the next page from the Link header, or an
+// empty string on the last page.
+func nextLink(resp *http.Response) (string, error) {
+	link := resp.Header.Get("Link")
+
+	if link == "" {
+		return "", nil
+	}
+
+	start := strings.IndexByte(link, '<')
+	end := strings.IndexByte(link, '>')
+
+	if start != 0 || end == -1 {
+		return "", fmt.Errorf("invalid Link header '%s'", link)
+	}
+
+	u, err := resp.Request.URL.Parse(link[1:end])
+
+	if err != nil {
+		return "", fmt.Errorf("invalid Link header '%s': %w", link, err)
+	}
+
+	return u.String(), nil
+}
@@ -0,0 +1,139 @@
+package oras
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/zeitlos/knockknock/config"
+
+	"oras.land/oras-go/v2/registry/remote"
+	"oras.land/oras-go/v2/registry/remote/auth"
+	"oras.land/oras-go/v2/registry/remote/credentials"
+	"oras.land/oras-go/v2/registry/remote/retry"
+)
+
+// newRepository connects to a repository with static credentials, or the
+// Docker credential store when authConfig is nil.
+func newRepository(reference string, authConfig *config.AuthConfig, tlsConfig *config.TLSConfig, plainHTTP bool, proxy string) (*remote.Repository, error) {
+	repo, err := remote.NewRepository(reference)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid repository: %w", err)
+	}
+
+	var credential auth.CredentialFunc
+
+	if authConfig != nil {
+		credential = auth.StaticCredential(repo.Reference.Registry, auth.Credential{
+			Username:    authConfig.Username,
+			Password:    authConfig.Password,
+			AccessToken: authConfig.Token,
+		})
+	} else {
+		store, err := credentials.NewStoreFromDocker(credentials.StoreOptions{})
+
+		if err != nil {
+			return nil, err
+		}
+
+		credential = credentials.Credential(store)
+	}
+
+	client := retry.DefaultClient
+
+	if tlsConfig != nil || proxy != "" {
+		client, err = newHTTPClient(tlsConfig, proxy)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid transport config for %s: %w", reference, err)
+		}
+	}
+
+	if tlsConfig != nil && tlsConfig.InsecureSkipVerify && !plainHTTP {
+		slog.Warn("certificate verification is disabled", "repo", reference)
+	}
+
+	repo.PlainHTTP = plainHTTP
+
+	repo.Client = &auth.Client{
+		Client:     client,
+		Cache:      auth.NewCache(),
+		Credential: credential,
+	}
+
+	return repo, nil
+}
+
+// newHTTPClient returns a retrying HTTP client using tlsConfig, which may be
+// nil, and the proxy URL, if any.
+func newHTTPClient(tlsConfig *config.TLSConfig, proxy string) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if proxy != "" {
+		proxyURL, err := url.Parse(proxy)
+
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy url '%s'", proxy)
+		}
+
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if tlsConfig == nil {
+		return &http.Client{Transport: retry.NewTransport(transport)}, nil
+	}
+
+	clientTLS := &tls.Config{
+		InsecureSkipVerify: tlsConfig.InsecureSkipVerify,
+	}
+
+	if tlsConfig.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		pem, err := os.ReadFile(tlsConfig.CAFile)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", tlsConfig.CAFile)
+		}
+
+		clientTLS.RootCAs = pool
+	}
+
+	if tlsConfig.CertFile != "" || tlsConfig.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(tlsConfig.CertFile, tlsConfig.KeyFile)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+
+		clientTLS.Certificates = []tls.Certificate{cert}
+	}
+
+	transport.TLSClientConfig = clientTLS
+
+	return &http.Client{Transport: retry.NewTransport(transport)}, nil
+}
+
+// baseURL returns the URL of the registry API root for repo.
+func baseURL(repo *remote.Repository) string {
+	scheme := "https"
+
+	if repo.PlainHTTP {
+		scheme = "http"
+	}
+
+	return fmt.Sprintf("%s://%s/v2/", scheme, repo.Reference.Host())
+}
@@ -0,0 +1,209 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/opencontainers/go-digest"
+)
+
+// Directory offers the versions found in a local or mounted directory, laid
+// out as <dir>/<version>/<files>. Each version directory holds the binary and
+// any files shipped with it.
+type Directory struct {
+	dir string
+}
+
+func NewDirectory(dir string) *Directory {
+	return &Directory{dir: dir}
+}
+
+func (d *Directory) Versions(ctx context.Context) ([]semver.Version, error) {
+	entries, err := os.ReadDir(d.dir)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", d.dir, err)
+	}
+
+	var versions []semver.Version
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		v, err := semver.NewVersion(entry.Name())
+
+		if err != nil {
+			// Skip non-semver directories
+			continue
+		}
+
+		versions = append(versions, *v)
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].LessThan(&versions[j])
+	})
+
+	return versions, nil
+}
+
+// Resolve returns a digest over the names and digests of the version's
+// files, so it changes whenever any of them does.
+func (d *Directory) Resolve(ctx context.Context, version string) (digest.Digest, error) {
+	files, err := d.files(version)
+
+	if err != nil {
+		return "", err
+	}
+
+	var listing strings.Builder
+
+	for _, file := range files {
+		fileDigest, err := digestFile(filepath.Join(d.dir, version, file.Name()))
+
+		if err != nil {
+			return "", err
+		}
+
+		fmt.Fprintf(&listing, "%s %s\n", fileDigest, file.Name())
+	}
+
+	return digest.FromString(listing.String()), nil
+}
+
+func (d *Directory) Download(ctx context.Context, version, destDir string, progress ProgressFunc) error {
+	files, err := d.files(version)
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return fmt.Errorf("failed to create destination dir: %w", err)
+	}
+
+	var total int64
+
+	for _, file := range files {
+		total += file.Size()
+	}
+
+	report := throttle(progress, total)
+
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		f, err := os.Open(filepath.Join(d.dir, version, file.Name()))
+
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", file.Name(), err)
+		}
+
+		err = writeFile(destDir, file.Name(), f, "", file.Size(), report)
+		f.Close()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *Directory) Metadata(ctx context.Context, version string) (*Metadata, error) {
+	files, err := d.files(version)
+
+	if err != nil {
+		return nil, err
+	}
+
+	dgst, err := d.Resolve(ctx, version)
+
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := &Metadata{
+		Version: version,
+		Digest:  dgst,
+	}
+
+	for _, file := range files {
+		metadata.Size += file.Size()
+
+		if file.ModTime().After(metadata.Created) {
+			metadata.Created = file.ModTime()
+		}
+	}
+
+	return metadata, nil
+}
+
+// files returns the regular files of a version, sorted by name.
+func (d *Directory) files(version string) ([]os.FileInfo, error) {
+	if _, err := semver.NewVersion(version); err != nil {
+		return nil, fmt.Errorf("invalid version '%s': %w", version, err)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(d.dir, version))
+
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrVersionNotFound, version)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read version %s: %w", version, err)
+	}
+
+	var files []os.FileInfo
+
+	for _, entry := range entries {
+		// Skip hidden files, e.g. partial copies onto a file share
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		// Stat follows symlinks, which are common on mounted volumes
+		info, err := os.Stat(filepath.Join(d.dir, version, entry.Name()))
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat %s: %w", entry.Name(), err)
+		}
+
+		if info.Mode().IsRegular() {
+			files = append(files, info)
+		}
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("version %s has no files", version)
+	}
+
+	return files, nil
+}
+
+func digestFile(path string) (digest.Digest, error) {
+	f, err := os.Open(path)
+
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	dgst, err := digest.FromReader(f)
+
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	return dgst, nil
+}
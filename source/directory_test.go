@@ -0,0 +1,138 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDirectoryVersions(t *testing.T) {
+	dir := t.TempDir()
+
+	writeFiles(t, dir, map[string]string{
+		"1.10.0/app":      "c",
+		"1.2.0/app":       "b",
+		"v1.0.0/app":      "a",
+		"latest/app":      "skipped, not semver",
+		".1.3.0/app":      "skipped, hidden",
+		"1.4.0":           "skipped, a file",
+		"1.2.0/.app.part": "skipped, hidden",
+	})
+
+	versions, err := NewDirectory(dir).Versions(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+
+	for _, v := range versions {
+		got = append(got, v.Original())
+	}
+
+	if len(got) != 3 || got[0] != "v1.0.0" || got[1] != "1.2.0" || got[2] != "1.10.0" {
+		t.Fatalf("expected the semver directories in order, got %v", got)
+	}
+}
+
+func TestDirectoryResolve(t *testing.T) {
+	dir := t.TempDir()
+
+	writeFiles(t, dir, map[string]string{
+		"1.0.0/app":       "binary",
+		"1.0.0/config":    "config",
+		"1.0.0/.app.part": "partial",
+		"1.1.0/app":       "binary",
+		"1.1.0/config":    "config",
+		"1.2.0/app":       "binary",
+		"1.2.0/config":    "changed",
+		"1.3.0/.hidden":   "only hidden",
+	})
+
+	d := NewDirectory(dir)
+
+	resolve := func(version string) string {
+		t.Helper()
+
+		dgst, err := d.Resolve(context.Background(), version)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return dgst.String()
+	}
+
+	// The same files resolve to the same digest, hidden files don't count
+	if resolve("1.0.0") != resolve("1.1.0") {
+		t.Fatal("expected identical versions to resolve to the same digest")
+	}
+
+	if resolve("1.0.0") == resolve("1.2.0") {
+		t.Fatal("expected a changed file to change the digest")
+	}
+
+	before := resolve("1.2.0")
+
+	writeFiles(t, dir, map[string]string{"1.2.0/config": "changed again"})
+
+	if resolve("1.2.0") == before {
+		t.Fatal("expected the digest to follow the file content")
+	}
+
+	if _, err := d.Resolve(context.Background(), "2.0.0"); !errors.Is(err, ErrVersionNotFound) {
+		t.Fatalf("expected ErrVersionNotFound, got %v", err)
+	}
+
+	if _, err := d.Resolve(context.Background(), "1.3.0"); err == nil {
+		t.Fatal("expected a version with only hidden files to fail")
+	}
+
+	if _, err := d.Resolve(context.Background(), "../1.0.0"); err == nil {
+		t.Fatal("expected a non-semver version to be rejected")
+	}
+}
+
+func TestDirectoryDownload(t *testing.T) {
+	dir := t.TempDir()
+
+	writeFiles(t, dir, map[string]string{
+		"1.0.0/app":       "binary",
+		"1.0.0/.app.part": "partial",
+	})
+
+	dest := filepath.Join(t.TempDir(), "1.0.0")
+
+	if err := NewDirectory(dir).Download(context.Background(), "1.0.0", dest, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(dest)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 || entries[0].Name() != "app" {
+		t.Fatalf("expected only the app to be copied, got %v", entries)
+	}
+}
@@ -0,0 +1,280 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/opencontainers/go-digest"
+)
+
+// HTTPIndex offers the versions listed in a static JSON index, so releases
+// can be served by any web server or bucket:
+//
+//	{
+//	  "versions": [
+//	    {
+//	      "version": "1.2.0",
+//	      "url": "1.2.0/myapp",
+//	      "digest": "sha256:...",
+//	      "size": 8123456
+//	    }
+//	  ]
+//	}
+//
+// URLs are resolved relative to the index. The file is stored under the last
+// element of its URL path unless the entry sets "name".
+type HTTPIndex struct {
+	url    *url.URL
+	client *http.Client
+}
+
+// Index is the document served at the index URL.
+type Index struct {
+	Versions []IndexEntry `json:"versions"`
+}
+
+type IndexEntry struct {
+	Version     string            `json:"version"`
+	URL         string            `json:"url"`
+	Name        string            `json:"name,omitempty"`
+	Digest      digest.Digest     `json:"digest"`
+	Size        int64             `json:"size,omitempty"`
+	Created     time.Time         `json:"created,omitzero"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// Notes, Critical and MinSupervisorVersion override the corresponding
+	// annotations.
+	Notes                string `json:"notes,omitempty"`
+	Critical             bool   `json:"critical,omitempty"`
+	MinSupervisorVersion string `json:"min_supervisor_version,omitempty"`
+}
+
+// NewHTTPIndex creates a source for the index at indexURL. A nil client uses
+// http.DefaultClient.
+func NewHTTPIndex(indexURL string, client *http.Client) (*HTTPIndex, error) {
+	u, err := url.Parse(indexURL)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid index url: %w", err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid index url '%s': scheme must be http or https", indexURL)
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &HTTPIndex{
+		url:    u,
+		client: client,
+	}, nil
+}
+
+var _ ConditionalSource = (*HTTPIndex)(nil)
+
+func (h *HTTPIndex) Versions(ctx context.Context) ([]semver.Version, error) {
+	versions, _, err := h.VersionsIfChanged(ctx, "")
+
+	return versions, err
+}
+
+// VersionsIfChanged fetches the index with If-None-Match, so web servers
+// answer with 304 Not Modified while it is unchanged.
+func (h *HTTPIndex) VersionsIfChanged(ctx context.Context, etag string) ([]semver.Version, string, error) {
+	index, etag, err := h.fetchIndex(ctx, etag)
+
+	if err != nil {
+		return nil, etag, err
+	}
+
+	var versions []semver.Version
+
+	for _, entry := range index.Versions {
+		v, err := semver.NewVersion(entry.Version)
+
+		if err != nil {
+			continue
+		}
+
+		versions = append(versions, *v)
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].LessThan(&versions[j])
+	})
+
+	return versions, etag, nil
+}
+
+func (h *HTTPIndex) Resolve(ctx context.Context, version string) (digest.Digest, error) {
+	entry, err := h.entry(ctx, version)
+
+	if err != nil {
+		return "", err
+	}
+
+	return entry.Digest, nil
+}
+
+func (h *HTTPIndex) Download(ctx context.Context, version, destDir string, progress ProgressFunc) error {
+	entry, err := h.entry(ctx, version)
+
+	if err != nil {
+		return err
+	}
+
+	fileURL, err := h.url.Parse(entry.URL)
+
+	if err != nil {
+		return fmt.Errorf("invalid url for version %s: %w", version, err)
+	}
+
+	name := entry.Name
+
+	// A URL ending in a slash names a directory, not a file
+	if name == "" && !strings.HasSuffix(fileURL.Path, "/") {
+		name = path.Base(fileURL.Path)
+	}
+
+	if name == "" || name == "/" || name == "." || name == ".." || path.Base(name) != name {
+		return fmt.Errorf("invalid file name '%s' for version %s", name, version)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fileURL.String(), nil)
+
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := h.client.Do(req)
+
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", fileURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download %s: %s", fileURL, resp.Status)
+	}
+
+	size := entry.Size
+
+	if size == 0 && resp.ContentLength > 0 {
+		size = resp.ContentLength
+	}
+
+	return writeFile(destDir, name, resp.Body, entry.Digest, entry.Size, throttle(progress, size))
+}
+
+func (h *HTTPIndex) Metadata(ctx context.Context, version string) (*Metadata, error) {
+	entry, err := h.entry(ctx, version)
+
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := &Metadata{
+		Version: entry.Version,
+		Digest:  entry.Digest,
+		Size:    entry.Size,
+	}
+
+	metadata.SetAnnotations(entry.Annotations)
+
+	if !entry.Created.IsZero() {
+		metadata.Created = entry.Created
+	}
+
+	if entry.Notes != "" {
+		metadata.Notes = entry.Notes
+	}
+
+	if entry.MinSupervisorVersion != "" {
+		metadata.MinSupervisorVersion = entry.MinSupervisorVersion
+	}
+
+	metadata.Critical = metadata.Critical || entry.Critical
+
+	return metadata, nil
+}
+
+// entry looks up version in the index. Versions are compared as semver, so
+// "v1.2.0" in the index matches "1.2.0".
+func (h *HTTPIndex) entry(ctx context.Context, version string) (*IndexEntry, error) {
+	want, err := semver.NewVersion(version)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid version '%s': %w", version, err)
+	}
+
+	index, _, err := h.fetchIndex(ctx, "")
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range index.Versions {
+		v, err := semver.NewVersion(entry.Version)
+
+		if err != nil || !v.Equal(want) {
+			continue
+		}
+
+		if err := entry.Digest.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid digest for version %s: %w", version, err)
+		}
+
+		return &entry, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrVersionNotFound, version)
+}
+
+// fetchIndex fetches the index and returns it with its ETag. If etag is set
+// and still matches, ErrNotModified is returned.
+func (h *HTTPIndex) fetchIndex(ctx context.Context, etag string) (*Index, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.url.String(), nil)
+
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := h.client.Do(req)
+
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to fetch index: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, etag, ErrNotModified
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("failed to fetch index: %s", resp.Status)
+	}
+
+	var index Index
+
+	if err := json.NewDecoder(resp.Body).Decode(&index); err != nil {
+		return nil, "", fmt.Errorf("failed to parse index: %w", err)
+	}
+
+	return &index, resp.Header.Get("ETag"), nil
+}
@@ -0,0 +1,289 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// indexServer serves index at /releases/index.json with a fixed ETag, and
+// files relative to it. requests counts the requests served, it may be nil.
+func indexServer(t *testing.T, index Index, files map[string]string, requests *atomic.Int32) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests != nil {
+			requests.Add(1)
+		}
+
+		if r.URL.Path == "/releases/index.json" {
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+
+			w.Header().Set("ETag", `"v1"`)
+			json.NewEncoder(w).Encode(index)
+
+			return
+		}
+
+		content, ok := files[r.URL.Path]
+
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Write([]byte(content))
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func newIndex(t *testing.T, server *httptest.Server) *HTTPIndex {
+	t.Helper()
+
+	index, err := NewHTTPIndex(server.URL+"/releases/index.json", server.Client())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return index
+}
+
+func TestHTTPIndexNotModified(t *testing.T) {
+	server := indexServer(t, Index{Versions: []IndexEntry{
+		{Version: "1.1.0", URL: "1.1.0/app", Digest: digest.FromString("b")},
+		{Version: "1.0.0", URL: "1.0.0/app", Digest: digest.FromString("a")},
+		{Version: "latest", URL: "latest/app", Digest: digest.FromString("c")},
+	}}, nil, nil)
+
+	index := newIndex(t, server)
+
+	versions, etag, err := index.VersionsIfChanged(context.Background(), "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if etag != `"v1"` {
+		t.Fatalf("expected the ETag of the index, got %q", etag)
+	}
+
+	if len(versions) != 2 || versions[0].String() != "1.0.0" || versions[1].String() != "1.1.0" {
+		t.Fatalf("expected the sorted semver versions, got %v", versions)
+	}
+
+	_, same, err := index.VersionsIfChanged(context.Background(), etag)
+
+	if !errors.Is(err, ErrNotModified) {
+		t.Fatalf("expected ErrNotModified, got %v", err)
+	}
+
+	if same != etag {
+		t.Fatalf("expected the ETag to be kept, got %q", same)
+	}
+}
+
+func TestHTTPIndexDownload(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry IndexEntry
+		file  string
+	}{
+		{
+			name:  "relative to the index",
+			entry: IndexEntry{URL: "1.0.0/app"},
+			file:  "app",
+		},
+		{
+			name:  "absolute path",
+			entry: IndexEntry{URL: "/downloads/app-linux"},
+			file:  "app-linux",
+		},
+		{
+			name:  "parent directory",
+			entry: IndexEntry{URL: "../downloads/app-linux"},
+			file:  "app-linux",
+		},
+		{
+			name:  "explicit name",
+			entry: IndexEntry{URL: "1.0.0/app", Name: "myapp"},
+			file:  "myapp",
+		},
+	}
+
+	files := map[string]string{
+		"/releases/1.0.0/app":  "release",
+		"/downloads/app-linux": "release",
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := tt.entry
+			entry.Version = "1.0.0"
+			entry.Digest = digest.FromString("release")
+			entry.Size = int64(len("release"))
+
+			index := newIndex(t, indexServer(t, Index{Versions: []IndexEntry{entry}}, files, nil))
+
+			dest := t.TempDir()
+
+			var done, total int64
+
+			err := index.Download(context.Background(), "v1.0.0", dest, func(d, t int64) {
+				done, total = d, t
+			})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(filepath.Join(dest, tt.file))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(data) != "release" {
+				t.Fatalf("unexpected content %q", data)
+			}
+
+			if done != total || total != entry.Size {
+				t.Fatalf("expected progress to reach %d, got %d of %d", entry.Size, done, total)
+			}
+		})
+	}
+}
+
+func TestHTTPIndexRejectsInvalidNames(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry IndexEntry
+	}{
+		{name: "traversal in name", entry: IndexEntry{URL: "1.0.0/app", Name: "../app"}},
+		{name: "nested name", entry: IndexEntry{URL: "1.0.0/app", Name: "bin/app"}},
+		{name: "dot dot name", entry: IndexEntry{URL: "1.0.0/app", Name: ".."}},
+		{name: "dot name", entry: IndexEntry{URL: "1.0.0/app", Name: "."}},
+		{name: "directory url", entry: IndexEntry{URL: "1.0.0/"}},
+		{name: "root url", entry: IndexEntry{URL: "/"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := tt.entry
+			entry.Version = "1.0.0"
+			entry.Digest = digest.FromString("release")
+
+			var requests atomic.Int32
+
+			index := newIndex(t, indexServer(t, Index{Versions: []IndexEntry{entry}}, nil, &requests))
+
+			dir := t.TempDir()
+			dest := filepath.Join(dir, "dest")
+
+			if err := os.Mkdir(dest, 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			err := index.Download(context.Background(), "1.0.0", dest, nil)
+
+			if err == nil || !strings.Contains(err.Error(), "invalid file name") {
+				t.Fatalf("expected an invalid file name error, got %v", err)
+			}
+
+			// Only the index was fetched
+			if n := requests.Load(); n != 1 {
+				t.Fatalf("expected no download, got %d requests", n)
+			}
+
+			if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+				t.Fatalf("expected nothing written next to dest, got %d entries", len(entries))
+			}
+		})
+	}
+}
+
+func TestHTTPIndexVerifiesDownloads(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		size    int64
+		err     string
+	}{
+		{name: "wrong content", content: "tampered", err: "digest mismatch"},
+		{name: "truncated", content: "relea", size: int64(len("release")), err: "size mismatch"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := IndexEntry{
+				Version: "1.0.0",
+				URL:     "1.0.0/app",
+				Digest:  digest.FromString("release"),
+				Size:    tt.size,
+			}
+
+			index := newIndex(t, indexServer(t, Index{Versions: []IndexEntry{entry}}, map[string]string{
+				"/releases/1.0.0/app": tt.content,
+			}, nil))
+
+			dest := t.TempDir()
+
+			err := index.Download(context.Background(), "1.0.0", dest, nil)
+
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("expected %q, got %v", tt.err, err)
+			}
+
+			// Neither the file nor its temporary copy is left behind
+			if entries, _ := os.ReadDir(dest); len(entries) != 0 {
+				t.Fatalf("expected an empty destination, got %d entries", len(entries))
+			}
+		})
+	}
+}
+
+func TestHTTPIndexMetadata(t *testing.T) {
+	index := newIndex(t, indexServer(t, Index{Versions: []IndexEntry{{
+		Version:     "1.0.0",
+		URL:         "1.0.0/app",
+		Digest:      digest.FromString("release"),
+		Notes:       "Fixes",
+		Annotations: map[string]string{AnnotationCritical: "true", AnnotationNotes: "ignored"},
+	}}}, nil, nil))
+
+	metadata, err := index.Metadata(context.Background(), "1.0.0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if metadata.Notes != "Fixes" || !metadata.Critical || metadata.Digest != digest.FromString("release") {
+		t.Fatalf("unexpected metadata %+v", metadata)
+	}
+
+	if _, err := index.Metadata(context.Background(), "2.0.0"); !errors.Is(err, ErrVersionNotFound) {
+		t.Fatalf("expected ErrVersionNotFound, got %v", err)
+	}
+}
+
+func TestNewHTTPIndexRequiresHTTP(t *testing.T) {
+	for _, u := range []string{"file:///releases/index.json", "releases/index.json"} {
+		if _, err := NewHTTPIndex(u, nil); err == nil {
+			t.Errorf("expected %q to be rejected", u)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+// Package source defines where the supervisor finds new versions, and
+// provides update sources that work without an OCI registry: a local or
+// mounted directory and a static JSON index served over HTTP.
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// ErrVersionNotFound is returned for versions the source does not offer.
+var ErrVersionNotFound = errors.New("version not found")
+
+// ErrNotModified is returned by ConditionalSource when the versions did not
+// change since the previous listing.
+var ErrNotModified = errors.New("versions not modified")
+
+// ProgressFunc reports how many bytes of an update have been downloaded.
+type ProgressFunc func(done, total int64)
+
+// UpdateSource provides the versions the supervisor can update to.
+type UpdateSource interface {
+	// Versions returns the available versions in ascending order.
+	Versions(ctx context.Context) ([]semver.Version, error)
+	// Resolve returns the digest identifying the content of version.
+	Resolve(ctx context.Context, version string) (digest.Digest, error)
+	// Download stores the files of version, including the binary, in
+	// destDir.
+	Download(ctx context.Context, version, destDir string, progress ProgressFunc) error
+	// Metadata describes version without downloading it.
+	Metadata(ctx context.Context, version string) (*Metadata, error)
+}
+
+// ConditionalSource is implemented by sources that can tell cheaply whether
+// their versions changed, e.g. with HTTP conditional requests.
+type ConditionalSource interface {
+	// VersionsIfChanged lists the versions like Versions, along with a tag
+	// identifying the listing. It returns ErrNotModified if the listing
+	// still matches etag.
+	VersionsIfChanged(ctx context.Context, etag string) ([]semver.Version, string, error)
+}
+
+// TransferCounter is implemented by sources whose download progress also
+// covers bytes they did not transfer, e.g. served from a cache or kept from
+// an interrupted download.
+type TransferCounter interface {
+	// CountTransfers makes the source call fn with the number of bytes it
+	// reads from the network.
+	CountTransfers(fn func(n int64))
+}
+
+// Annotations describing a release, set on the manifest with e.g.
+// `oras push --annotation`.
+const (
+	// AnnotationNotes holds the release notes. The image description is
+	// used when it is missing.
+	AnnotationNotes = "io.knockknock.notes"
+	// AnnotationCritical marks a release apps should urge users to install,
+	// e.g. a security fix, when set to "true".
+	AnnotationCritical = "io.knockknock.critical"
+	// AnnotationMinSupervisorVersion is the oldest running version that may
+	// update to the release, e.g. because of a migration in between.
+	AnnotationMinSupervisorVersion = "io.knockknock.min-supervisor-version"
+)
+
+// Metadata describes a version offered by an update source.
+type Metadata struct {
+	Version string
+	Digest  digest.Digest
+	// Size is the number of bytes downloaded for the version.
+	Size                 int64
+	Created              time.Time
+	Notes                string
+	Critical             bool
+	MinSupervisorVersion string
+	Annotations          map[string]string
+}
+
+// SetAnnotations stores annotations and fills the fields derived from the
+// well-known ones.
+func (m *Metadata) SetAnnotations(annotations map[string]string) {
+	m.Annotations = annotations
+
+	if created, err := time.Parse(time.RFC3339, annotations[ocispec.AnnotationCreated]); err == nil {
+		m.Created = created
+	}
+
+	m.Notes = annotations[AnnotationNotes]
+
+	if m.Notes == "" {
+		m.Notes = annotations[ocispec.AnnotationDescription]
+	}
+
+	m.Critical, _ = strconv.ParseBool(annotations[AnnotationCritical])
+	m.MinSupervisorVersion = annotations[AnnotationMinSupervisorVersion]
+}
+
+// CheckSupervisorVersion returns an error if a supervisor running current
+// may not update to the version.
+func (m *Metadata) CheckSupervisorVersion(current *semver.Version) error {
+	if m.MinSupervisorVersion == "" {
+		return nil
+	}
+
+	min, err := semver.NewVersion(m.MinSupervisorVersion)
+
+	if err != nil {
+		return fmt.Errorf("invalid minimum supervisor version '%s' for %s: %w", m.MinSupervisorVersion, m.Version, err)
+	}
+
+	if current.LessThan(min) {
+		return fmt.Errorf("version %s requires %s or newer to update from, running %s", m.Version, min, current)
+	}
+
+	return nil
+}
+
+// writeFile copies r into destDir/name, verifying the content against
+// expected and size when they are set. The file is only moved into place
+// once it is complete.
+func writeFile(destDir, name string, r io.Reader, expected digest.Digest, size int64, progress func(n int64)) error {
+	dest := filepath.Join(destDir, name)
+
+	f, err := os.CreateTemp(destDir, "."+name+".*")
+
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", name, err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	algorithm := digest.Canonical
+
+	if expected != "" {
+		if err := expected.Validate(); err != nil {
+			return fmt.Errorf("invalid digest for %s: %w", name, err)
+		}
+
+		algorithm = expected.Algorithm()
+	}
+
+	digester := algorithm.Digester()
+
+	n, err := io.Copy(io.MultiWriter(f, digester.Hash(), progressWriter(progress)), r)
+
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+
+	if size > 0 && n != size {
+		return fmt.Errorf("size mismatch for %s: expected %d bytes, got %d", name, size, n)
+	}
+
+	if expected != "" && digester.Digest() != expected {
+		return fmt.Errorf("digest mismatch for %s: expected %s, got %s", name, expected, digester.Digest())
+	}
+
+	if err := f.Chmod(0755); err != nil {
+		return fmt.Errorf("failed to chmod %s: %w", name, err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+
+	if err := os.Rename(f.Name(), dest); err != nil {
+		return fmt.Errorf("failed to move %s into place: %w", name, err)
+	}
+
+	return nil
+}
+
+// progressWriter calls progress with the size of every write.
+type progressWriter func(n int64)
+
+func (p progressWriter) Write(b []byte) (int, error) {
+	if p != nil {
+		p(int64(len(b)))
+	}
+
+	return len(b), nil
+}
+
+// throttle wraps progress so it is called at most once per percent of total,
+// and once the download completed.
+func throttle(progress ProgressFunc, total int64) func(n int64) {
+	var done, reported int64
+
+	return func(n int64) {
+		done += n
+
+		if progress == nil {
+			return
+		}
+
+		if done-reported >= total/100 || done >= total {
+			reported = done
+			progress(done, total)
+		}
+	}
+}
@@ -0,0 +1,374 @@
+package supervisor
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+type CrashClass string
+
+const (
+	CrashGoPanic    CrashClass = "go-panic"
+	CrashFatalError CrashClass = "fatal-error"
+	CrashOOMKill    CrashClass = "oom-kill"
+	CrashSegfault   CrashClass = "sigsegv"
+	CrashSignal     CrashClass = "signal"
+	CrashUserExit   CrashClass = "user-exit"
+	// CrashStartupTimeout is a child that was killed because it did not say
+	// hello within the startup timeout.
+	CrashStartupTimeout CrashClass = "startup-timeout"
+	// CrashWatchdogTimeout is a child that was killed because its heartbeats
+	// stopped. The report holds the goroutine dump taken before.
+	CrashWatchdogTimeout CrashClass = "watchdog-timeout"
+)
+
+// crashStderrLines is the number of stderr lines attached to a crash report.
+// Panic traces and goroutine dumps are parsed from up to crashTraceLines.
+const (
+	crashStderrLines = 200
+	crashTraceLines  = 2000
+)
+
+const crashTimeFormat = "20060102-150405.000000"
+
+// CrashReport describes a single non-zero exit or signal of the child. It is
+// persisted as crashes/<id>.json in the base path.
+type CrashReport struct {
+	ID            string      `json:"id"`
+	Time          time.Time   `json:"time"`
+	Version       string      `json:"version"`
+	PID           int         `json:"pid"`
+	ExitCode      int         `json:"exit_code"`
+	Signal        string      `json:"signal,omitempty"`
+	UptimeSeconds float64     `json:"uptime_seconds"`
+	Class         CrashClass  `json:"class"`
+	Stderr        []string    `json:"stderr,omitempty"`
+	Panic         *PanicTrace `json:"panic,omitempty"`
+}
+
+// PanicTrace is a Go panic or fatal error parsed from the child's stderr.
+type PanicTrace struct {
+	Message    string      `json:"message"`
+	Goroutines []Goroutine `json:"goroutines,omitempty"`
+}
+
+type Goroutine struct {
+	ID     int     `json:"id"`
+	State  string  `json:"state"`
+	Frames []Frame `json:"frames,omitempty"`
+}
+
+type Frame struct {
+	Function string `json:"function"`
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+}
+
+// crashExit describes how a child process ended.
+type crashExit struct {
+	pid       int
+	startedAt time.Time
+	exitCode  int
+	signal    syscall.Signal
+	oomKilled bool
+
+	startupTimeout  bool
+	watchdogTimeout bool
+}
+
+// forced reports whether the supervisor killed the child for not starting
+// or not sending heartbeats.
+func (e crashExit) forced() bool {
+	return e.startupTimeout || e.watchdogTimeout
+}
+
+// status returns the exit code the supervisor passes on for the exit,
+// following the shell convention of 128+n for signals.
+func (e crashExit) status() int {
+	if e.signal != 0 {
+		return 128 + int(e.signal)
+	}
+
+	return e.exitCode
+}
+
+// recordCrash builds a crash report for the exit, persists it and remembers
+// it as the last crash.
+func (s *Supervisor) recordCrash(exit crashExit) *CrashReport {
+	now := time.Now()
+
+	report := &CrashReport{
+		ID:            now.UTC().Format(crashTimeFormat),
+		Time:          now,
+		Version:       s.CurrentVersion().String(),
+		PID:           exit.pid,
+		ExitCode:      exit.exitCode,
+		UptimeSeconds: now.Sub(exit.startedAt).Seconds(),
+	}
+
+	stderr := s.output.stderrLines(exit.pid, crashTraceLines)
+
+	report.Stderr = stderr[max(0, len(stderr)-crashStderrLines):]
+	report.Panic = parsePanic(stderr)
+
+	if exit.signal != 0 {
+		report.Signal = exit.signal.String()
+	}
+
+	report.Class = classifyCrash(exit, report.Panic)
+
+	if err := s.saveCrashReport(report); err != nil {
+		slog.Warn("failed to save crash report", "error", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastCrash = report
+
+	return report
+}
+
+func classifyCrash(exit crashExit, trace *PanicTrace) CrashClass {
+	switch {
+	case exit.startupTimeout:
+		return CrashStartupTimeout
+	case exit.watchdogTimeout:
+		return CrashWatchdogTimeout
+	case exit.oomKilled:
+		return CrashOOMKill
+	case exit.signal == syscall.SIGSEGV || exit.signal == syscall.SIGBUS:
+		return CrashSegfault
+	case exit.signal != 0:
+		return CrashSignal
+	case trace != nil && signalHeader.MatchString(trace.Message):
+		return CrashSignal
+	case trace != nil && strings.HasPrefix(trace.Message, "fatal error:"):
+		return CrashFatalError
+	case trace != nil:
+		return CrashGoPanic
+	default:
+		return CrashUserExit
+	}
+}
+
+// Crashes returns the persisted crash reports, newest first.
+func (s *Supervisor) Crashes() ([]CrashReport, error) {
+	entries, err := os.ReadDir(s.crashDir())
+
+	if os.IsNotExist(err) {
+		return []CrashReport{}, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read crash directory: %w", err)
+	}
+
+	reports := []CrashReport{}
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(s.crashDir(), entry.Name()))
+
+		if err != nil {
+			slog.Warn("failed to read crash report", "file", entry.Name(), "error", err)
+			continue
+		}
+
+		var report CrashReport
+
+		if err := json.Unmarshal(data, &report); err != nil {
+			slog.Warn("failed to parse crash report", "file", entry.Name(), "error", err)
+			continue
+		}
+
+		reports = append(reports, report)
+	}
+
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].Time.After(reports[j].Time)
+	})
+
+	return reports, nil
+}
+
+func (s *Supervisor) crashDir() string {
+	return filepath.Join(s.basePath, "crashes")
+}
+
+func (s *Supervisor) saveCrashReport(report *CrashReport) error {
+	if s.config.MaxCrashReports <= 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(s.crashDir(), 0755); err != nil {
+		return fmt.Errorf("failed to create crash directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+
+	if err != nil {
+		return fmt.Errorf("failed to encode crash report: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(s.crashDir(), report.ID+".json"), data, 0644); err != nil {
+		return fmt.Errorf("failed to write crash report: %w", err)
+	}
+
+	return s.cleanupOldCrashReports(s.config.MaxCrashReports)
+}
+
+// cleanupOldCrashReports removes old crash reports, keeping only the most recent N
+func (s *Supervisor) cleanupOldCrashReports(keep int) error {
+	matches, err := filepath.Glob(filepath.Join(s.crashDir(), "*.json"))
+
+	if err != nil {
+		return err
+	}
+
+	// Names are timestamps, so lexical order is chronological
+	sort.Strings(matches)
+
+	if len(matches) > keep {
+		for _, file := range matches[:len(matches)-keep] {
+			if err := os.Remove(file); err != nil {
+				slog.Warn("failed to remove old crash report", "file", file, "error", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+var (
+	goroutineHeader = regexp.MustCompile(`^goroutine (\d+)(?: [^\[]*)? \[([^\]]*)\]:$`)
+	signalHeader    = regexp.MustCompile(`^SIG[A-Z]+: `)
+	frameLocation   = regexp.MustCompile(`^\t(.*):(\d+)(?: \+0x[0-9a-f]+)?(?: fp=.*)?$`)
+)
+
+// parsePanic extracts the last Go panic, fatal error or signal dump such as
+// SIGQUIT from stderr lines.
+func parsePanic(lines []string) *PanicTrace {
+	start := -1
+
+	for i, line := range lines {
+		if strings.HasPrefix(line, "panic: ") || strings.HasPrefix(line, "fatal error: ") || signalHeader.MatchString(line) {
+			start = i
+		}
+	}
+
+	if start < 0 {
+		return nil
+	}
+
+	trace := &PanicTrace{Message: lines[start]}
+
+	var current *Goroutine
+
+	inMessage := true
+
+	for _, line := range lines[start+1:] {
+		if m := goroutineHeader.FindStringSubmatch(line); m != nil {
+			id, _ := strconv.Atoi(m[1])
+
+			trace.Goroutines = append(trace.Goroutines, Goroutine{ID: id, State: m[2]})
+			current = &trace.Goroutines[len(trace.Goroutines)-1]
+
+			continue
+		}
+
+		if current == nil {
+			// Continuation of the panic message up to the first blank line,
+			// e.g. "[recovered]" or a multi-line error
+			if line == "" {
+				inMessage = false
+			} else if inMessage {
+				trace.Message += "\n" + line
+			}
+
+			continue
+		}
+
+		if m := frameLocation.FindStringSubmatch(line); m != nil {
+			if n := len(current.Frames); n > 0 {
+				current.Frames[n-1].File = m[1]
+				current.Frames[n-1].Line, _ = strconv.Atoi(m[2])
+			}
+
+			continue
+		}
+
+		if line == "" {
+			current = nil
+			continue
+		}
+
+		current.Frames = append(current.Frames, Frame{Function: line})
+	}
+
+	return trace
+}
+
+// oomKills returns the number of OOM kills in the supervisor's cgroup, which
+// the child shares. It returns -1 when cgroup v2 accounting is unavailable.
+func oomKills() int64 {
+	return cgroupOOMKills("/proc/self/cgroup", "/sys/fs/cgroup")
+}
+
+// cgroupOOMKills reads the oom_kill counter from memory.events of the cgroup
+// v2 group named in cgroupFile, below the cgroup filesystem at root.
+func cgroupOOMKills(cgroupFile, root string) int64 {
+	data, err := os.ReadFile(cgroupFile)
+
+	if err != nil {
+		return -1
+	}
+
+	var group string
+
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if path, ok := strings.CutPrefix(line, "0::"); ok {
+			group = path
+		}
+	}
+
+	if group == "" {
+		return -1
+	}
+
+	f, err := os.Open(filepath.Join(root, group, "memory.events"))
+
+	if err != nil {
+		return -1
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		if v, ok := strings.CutPrefix(scanner.Text(), "oom_kill "); ok {
+			n, err := strconv.ParseInt(v, 10, 64)
+
+			if err != nil {
+				return -1
+			}
+
+			return n
+		}
+	}
+
+	return -1
+}
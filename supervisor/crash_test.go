@@ -0,0 +1,275 @@
+package supervisor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// readDump returns the lines of a dump in testdata/crashes, captured from a
+// real Go program.
+func readDump(t *testing.T, name string) []string {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("testdata", "crashes", name))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+func TestParsePanic(t *testing.T) {
+	tests := []struct {
+		dump       string
+		before     []string
+		message    string
+		goroutines int
+		// first is the first frame of the first goroutine
+		first Frame
+		class CrashClass
+	}{
+		{
+			dump:       "panic.txt",
+			before:     []string{"2026/10/19 00:39:01 INFO starting", "2026/10/19 00:39:02 ERROR dial failed"},
+			message:    "panic: boom: connection refused",
+			goroutines: 1,
+			first:      Frame{Function: "main.main()", File: "/src/app/main.go", Line: 16},
+			class:      CrashGoPanic,
+		},
+		{
+			dump:       "multiline.txt",
+			message:    "panic: first line\n\tsecond line",
+			goroutines: 1,
+			first:      Frame{Function: "main.main()", File: "/src/app/main.go", Line: 18},
+			class:      CrashGoPanic,
+		},
+		{
+			dump:       "recovered.txt",
+			message:    "panic: again [recovered, repanicked]",
+			goroutines: 1,
+			first:      Frame{Function: "main.main.func2()", File: "/src/app/main.go", Line: 22},
+			class:      CrashGoPanic,
+		},
+		{
+			// A nil dereference in Go code is a panic, not a SIGSEGV exit
+			dump:       "segv.txt",
+			message:    "panic: runtime error: invalid memory address or nil pointer dereference\n[signal SIGSEGV: segmentation violation code=0x1 addr=0x0 pc=0x483248]",
+			goroutines: 1,
+			first:      Frame{Function: "main.main()", File: "/src/app/main.go", Line: 37},
+			class:      CrashGoPanic,
+		},
+		{
+			dump:       "deadlock.txt",
+			message:    "fatal error: all goroutines are asleep - deadlock!",
+			goroutines: 1,
+			first:      Frame{Function: "main.main()", File: "/src/app/main.go", Line: 40},
+			class:      CrashFatalError,
+		},
+		{
+			dump:       "quit.txt",
+			message:    "SIGQUIT: quit\nPC=0x40c84e m=0 sigcode=0",
+			goroutines: 8,
+			first: Frame{
+				Function: "internal/runtime/syscall/linux.Syscall6()",
+				File:     "/usr/local/go/src/internal/runtime/syscall/linux/asm_linux_amd64.s",
+				Line:     36,
+			},
+			class: CrashSignal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dump, func(t *testing.T) {
+			lines := append(tt.before, readDump(t, tt.dump)...)
+
+			trace := parsePanic(lines)
+
+			if trace == nil {
+				t.Fatal("no panic found")
+			}
+
+			if trace.Message != tt.message {
+				t.Fatalf("message %q, expected %q", trace.Message, tt.message)
+			}
+
+			if len(trace.Goroutines) != tt.goroutines {
+				t.Fatalf("found %d goroutines, expected %d", len(trace.Goroutines), tt.goroutines)
+			}
+
+			if frames := trace.Goroutines[0].Frames; len(frames) == 0 || frames[0] != tt.first {
+				t.Fatalf("first frame %+v, expected %+v", frames, tt.first)
+			}
+
+			if class := classifyCrash(crashExit{exitCode: 2}, trace); class != tt.class {
+				t.Fatalf("classified as %s, expected %s", class, tt.class)
+			}
+		})
+	}
+}
+
+func TestParsePanicGoroutineDump(t *testing.T) {
+	trace := parsePanic(readDump(t, "quit.txt"))
+
+	want := []struct {
+		id    int
+		state string
+	}{
+		{0, "idle"},
+		{1, "select (no cases)"},
+		{2, "force gc (idle)"},
+		{3, "GC sweep wait"},
+		{4, "GC scavenge wait"},
+		{5, "GOMAXPROCS updater (idle)"},
+		{6, "finalizer wait"},
+		{7, "sleep"},
+	}
+
+	for i, g := range trace.Goroutines {
+		if g.ID != want[i].id || g.State != want[i].state {
+			t.Errorf("goroutine %d is %d [%s], expected %d [%s]", i, g.ID, g.State, want[i].id, want[i].state)
+		}
+	}
+
+	// Frames without an offset, and the register dump after the last
+	// goroutine, are kept apart
+	sleeping := trace.Goroutines[7].Frames
+
+	if len(sleeping) != 5 {
+		t.Fatalf("expected 5 frames, got %+v", sleeping)
+	}
+
+	if sleeping[2] != (Frame{Function: "main.main.func4()", File: "/src/app/main.go", Line: 42}) {
+		t.Fatalf("unexpected frame %+v", sleeping[2])
+	}
+
+	if sleeping[4] != (Frame{Function: "created by main.main in goroutine 1", File: "/src/app/main.go", Line: 42}) {
+		t.Fatalf("unexpected frame %+v", sleeping[4])
+	}
+
+	park := trace.Goroutines[2].Frames[1]
+
+	if park != (Frame{Function: "runtime.goparkunlock(...)", File: "/usr/local/go/src/runtime/proc.go", Line: 480}) {
+		t.Fatalf("unexpected frame %+v", park)
+	}
+}
+
+func TestParsePanicLast(t *testing.T) {
+	// A panic recovered and logged earlier is not the one that crashed
+	lines := append([]string{"panic: handled earlier", "", "goroutine 9 [running]:", "main.handler()", ""}, readDump(t, "deadlock.txt")...)
+
+	if trace := parsePanic(lines); trace.Message != "fatal error: all goroutines are asleep - deadlock!" {
+		t.Fatalf("expected the last trace, got %q", trace.Message)
+	}
+
+	if trace := parsePanic([]string{"2026/10/19 00:39:01 INFO stopping", "bye"}); trace != nil {
+		t.Fatalf("expected no trace, got %+v", trace)
+	}
+}
+
+func TestClassifyCrash(t *testing.T) {
+	goPanic := &PanicTrace{Message: "panic: boom"}
+	quit := &PanicTrace{Message: "SIGQUIT: quit"}
+
+	tests := []struct {
+		name  string
+		exit  crashExit
+		trace *PanicTrace
+		want  CrashClass
+	}{
+		{name: "exit code", exit: crashExit{exitCode: 1}, want: CrashUserExit},
+		{name: "go panic", exit: crashExit{exitCode: 2}, trace: goPanic, want: CrashGoPanic},
+		{name: "fatal error", exit: crashExit{exitCode: 2}, trace: &PanicTrace{Message: "fatal error: concurrent map writes"}, want: CrashFatalError},
+		{name: "signal dump", exit: crashExit{exitCode: 2}, trace: quit, want: CrashSignal},
+		{name: "sigsegv", exit: crashExit{signal: syscall.SIGSEGV}, want: CrashSegfault},
+		{name: "sigbus", exit: crashExit{signal: syscall.SIGBUS}, want: CrashSegfault},
+		{name: "sigterm", exit: crashExit{signal: syscall.SIGTERM}, want: CrashSignal},
+		{name: "sigkill", exit: crashExit{signal: syscall.SIGKILL}, want: CrashSignal},
+		{name: "oom kill", exit: crashExit{signal: syscall.SIGKILL, oomKilled: true}, want: CrashOOMKill},
+		{name: "oom kill after a panic", exit: crashExit{signal: syscall.SIGKILL, oomKilled: true}, trace: goPanic, want: CrashOOMKill},
+		{name: "startup timeout", exit: crashExit{signal: syscall.SIGKILL, startupTimeout: true}, want: CrashStartupTimeout},
+		// The dump was requested by the watchdog, which is the cause
+		{name: "watchdog timeout", exit: crashExit{exitCode: 2, watchdogTimeout: true}, trace: quit, want: CrashWatchdogTimeout},
+		{name: "watchdog kill", exit: crashExit{signal: syscall.SIGKILL, watchdogTimeout: true}, want: CrashWatchdogTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyCrash(tt.exit, tt.trace); got != tt.want {
+				t.Fatalf("classified as %s, expected %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCgroupOOMKills(t *testing.T) {
+	tests := []struct {
+		name   string
+		cgroup string
+		events string
+		want   int64
+	}{
+		{
+			name:   "cgroup v2",
+			cgroup: "0::/system.slice/app.service\n",
+			events: "low 0\nhigh 0\nmax 12\noom 3\noom_kill 2\noom_group_kill 0\n",
+			want:   2,
+		},
+		{
+			name:   "hybrid hierarchy",
+			cgroup: "12:memory:/system.slice/app.service\n1:name=systemd:/system.slice/app.service\n0::/system.slice/app.service\n",
+			events: "oom 0\noom_kill 0\n",
+			want:   0,
+		},
+		{
+			name:   "cgroup v1 only",
+			cgroup: "12:memory:/system.slice/app.service\n",
+			want:   -1,
+		},
+		{
+			name:   "no memory controller",
+			cgroup: "0::/system.slice/app.service\n",
+			want:   -1,
+		},
+		{
+			name:   "invalid counter",
+			cgroup: "0::/system.slice/app.service\n",
+			events: "oom_kill many\n",
+			want:   -1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			cgroupFile := filepath.Join(root, "cgroup")
+
+			if err := os.WriteFile(cgroupFile, []byte(tt.cgroup), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.events != "" {
+				dir := filepath.Join(root, "system.slice", "app.service")
+
+				if err := os.MkdirAll(dir, 0755); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := os.WriteFile(filepath.Join(dir, "memory.events"), []byte(tt.events), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if got := cgroupOOMKills(cgroupFile, root); got != tt.want {
+				t.Fatalf("got %d OOM kills, expected %d", got, tt.want)
+			}
+		})
+	}
+
+	if got := cgroupOOMKills(filepath.Join(t.TempDir(), "missing"), "/"); got != -1 {
+		t.Fatalf("expected -1 without /proc/self/cgroup, got %d", got)
+	}
+}
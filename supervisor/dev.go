@@ -0,0 +1,199 @@
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/opencontainers/go-digest"
+	"github.com/zeitlos/knockknock/config"
+	"github.com/zeitlos/knockknock/source"
+)
+
+// devSource is the update source used in dev mode. It offers a fixed list of
+// versions and "downloads" each of them as a copy of the running executable,
+// so the regular update and rollback pipeline can be exercised locally.
+type devSource struct {
+	binaryName string
+	versions   []semver.Version
+}
+
+func newDevSource(config *config.Config, current *semver.Version) (*devSource, error) {
+	var versions []semver.Version
+
+	for _, v := range config.DevVersions {
+		version, err := semver.NewVersion(v)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid dev version '%s': %w", v, err)
+		}
+
+		versions = append(versions, *version)
+	}
+
+	// Offer a couple of newer versions so update UIs have something to show
+	if len(versions) == 0 {
+		versions = []semver.Version{*current, current.IncPatch(), current.IncMinor()}
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].LessThan(&versions[j])
+	})
+
+	return &devSource{
+		binaryName: config.BinaryName,
+		versions:   versions,
+	}, nil
+}
+
+func (d *devSource) Versions(ctx context.Context) ([]semver.Version, error) {
+	return d.versions, nil
+}
+
+// Resolve returns the digest of the running executable, which every dev
+// version is a copy of.
+func (d *devSource) Resolve(ctx context.Context, version string) (digest.Digest, error) {
+	if _, err := semver.NewVersion(version); err != nil {
+		return "", fmt.Errorf("invalid version '%s': %w", version, err)
+	}
+
+	dgst, _, err := digestExecutable()
+
+	return dgst, err
+}
+
+func (d *devSource) Metadata(ctx context.Context, version string) (*source.Metadata, error) {
+	if _, err := semver.NewVersion(version); err != nil {
+		return nil, fmt.Errorf("invalid version '%s': %w", version, err)
+	}
+
+	dgst, size, err := digestExecutable()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &source.Metadata{
+		Version: version,
+		Digest:  dgst,
+		Size:    size,
+	}, nil
+}
+
+func (d *devSource) Download(ctx context.Context, version, destDir string, progress source.ProgressFunc) error {
+	if _, err := semver.NewVersion(version); err != nil {
+		return fmt.Errorf("invalid version '%s': %w", version, err)
+	}
+
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return fmt.Errorf("failed to create destination dir: %w", err)
+	}
+
+	size, err := copyExecutable(filepath.Join(destDir, d.binaryName))
+
+	if err != nil {
+		return err
+	}
+
+	if progress != nil {
+		progress(size, size)
+	}
+
+	return nil
+}
+
+// prepareDevInstallation creates an installation directory with the running
+// executable installed as the current version.
+func prepareDevInstallation(config *config.Config) (string, error) {
+	dir := config.DevDir
+
+	if dir == "" {
+		tmp, err := os.MkdirTemp("", "knockknock-dev-")
+
+		if err != nil {
+			return "", fmt.Errorf("failed to create dev directory: %w", err)
+		}
+
+		dir = tmp
+	}
+
+	basePath := filepath.Join(dir, config.BinaryName)
+	versionDir := filepath.Join(basePath, "versions", config.Version)
+
+	if err := os.MkdirAll(versionDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create version directory: %w", err)
+	}
+
+	if _, err := copyExecutable(filepath.Join(versionDir, config.BinaryName)); err != nil {
+		return "", err
+	}
+
+	currentLink := filepath.Join(basePath, "current")
+
+	if _, err := os.Lstat(currentLink); os.IsNotExist(err) {
+		if err := os.Symlink(versionDir, currentLink); err != nil {
+			return "", fmt.Errorf("failed to create current symlink: %w", err)
+		}
+	}
+
+	return dir, nil
+}
+
+func digestExecutable() (digest.Digest, int64, error) {
+	exe, err := os.Executable()
+
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to locate executable: %w", err)
+	}
+
+	f, err := os.Open(exe)
+
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to open executable: %w", err)
+	}
+	defer f.Close()
+
+	digester := digest.Canonical.Digester()
+
+	size, err := io.Copy(digester.Hash(), f)
+
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read executable: %w", err)
+	}
+
+	return digester.Digest(), size, nil
+}
+
+func copyExecutable(dest string) (int64, error) {
+	exe, err := os.Executable()
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to locate executable: %w", err)
+	}
+
+	src, err := os.Open(exe)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to open executable: %w", err)
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(dest, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to create %s: %w", dest, err)
+	}
+	defer dst.Close()
+
+	n, err := io.Copy(dst, src)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to copy executable: %w", err)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,68 @@
+package supervisor
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/zeitlos/knockknock/config"
+)
+
+// drain asks the child to prepare for shutdown by publishing restart-imminent
+// and waits until it acknowledges through ReadyForRestart or the policy's
+// timeout elapses. Children that are not subscribed to events are not waited
+// for, as they cannot acknowledge.
+func (s *Supervisor) drain(reason config.RestartReason, version, message string) {
+	policy := s.config.DrainPolicyFor(reason)
+
+	if policy.Skip || s.events.subscribers() == 0 {
+		return
+	}
+
+	ack := make(chan struct{})
+
+	s.mu.Lock()
+	s.drainAck = ack
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.drainAck = nil
+		s.mu.Unlock()
+	}()
+
+	deadline := time.Now().Add(policy.Timeout)
+
+	s.publish(Event{
+		Type:     EventRestartImminent,
+		Version:  version,
+		Reason:   string(reason),
+		Message:  message,
+		Deadline: deadline,
+	})
+
+	timer := time.NewTimer(policy.Timeout)
+	defer timer.Stop()
+
+	select {
+	case <-ack:
+		slog.Info("child is ready for restart", "reason", reason)
+	case <-timer.C:
+		slog.Warn("child did not acknowledge restart in time", "reason", reason, "timeout", policy.Timeout)
+	}
+}
+
+// ReadyForRestart acknowledges a pending restart. It reports whether a
+// restart was actually pending.
+func (s *Supervisor) ReadyForRestart() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.drainAck == nil {
+		return false
+	}
+
+	close(s.drainAck)
+	s.drainAck = nil
+
+	return true
+}
@@ -0,0 +1,90 @@
+package supervisor
+
+import (
+	"sync"
+	"time"
+)
+
+type EventType string
+
+const (
+	EventUpdateAvailable   EventType = "update-available"
+	EventDownloadProgress  EventType = "download-progress"
+	EventUpdateReady       EventType = "update-ready"
+	EventRestartImminent   EventType = "restart-imminent"
+	EventRollback          EventType = "rollback"
+	EventCrashLoopDetected EventType = "crash-loop-detected"
+)
+
+type Event struct {
+	Type       EventType
+	Time       time.Time
+	Version    string
+	Reason     string
+	Message    string
+	Deadline   time.Time
+	BytesDone  int64
+	BytesTotal int64
+}
+
+// events fans out supervisor events to all subscribers. Slow subscribers
+// miss events rather than blocking the supervisor.
+type events struct {
+	mu   sync.Mutex
+	subs map[chan Event]struct{}
+}
+
+func (e *events) subscribe() (<-chan Event, func()) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.subs == nil {
+		e.subs = map[chan Event]struct{}{}
+	}
+
+	ch := make(chan Event, 64)
+	e.subs[ch] = struct{}{}
+
+	return ch, func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+
+		if _, ok := e.subs[ch]; ok {
+			delete(e.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+func (e *events) publish(event Event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for ch := range e.subs {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+func (e *events) subscribers() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return len(e.subs)
+}
+
+// Subscribe returns a channel receiving all future events. The returned
+// function unsubscribes and closes the channel.
+func (s *Supervisor) Subscribe() (<-chan Event, func()) {
+	return s.events.subscribe()
+}
+
+func (s *Supervisor) publish(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	s.events.publish(event)
+}
@@ -0,0 +1,207 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/zeitlos/knockknock/oras"
+)
+
+// ErrInvalidImport is returned when a path to import is not an OCI image
+// layout with a version tag.
+var ErrInvalidImport = errors.New("invalid import")
+
+const importPollInterval = 5 * time.Second
+
+// Subdirectories of the import directory that processed layouts are moved to.
+const (
+	importedDir = "imported"
+	failedDir   = "failed"
+)
+
+// StartImport installs the version in an OCI image layout, a directory or a
+// tar archive of one, through the same pipeline as an update. The layout's
+// highest semver tag is the version.
+func (s *Supervisor) StartImport(path string) (Job, error) {
+	return s.startImport(path, nil)
+}
+
+// startImport starts an import job. settle is called with true once the
+// version was activated, before the restart, or with false if the import
+// failed before that.
+func (s *Supervisor) startImport(path string, settle func(installed bool)) (Job, error) {
+	layout, err := oras.NewLayoutClient(context.Background(), s.config, path)
+
+	if err != nil {
+		return Job{}, fmt.Errorf("%w: %w", ErrInvalidImport, err)
+	}
+
+	versions, err := layout.Versions(context.Background())
+
+	if err != nil {
+		return Job{}, fmt.Errorf("%w: %w", ErrInvalidImport, err)
+	}
+
+	if len(versions) == 0 {
+		return Job{}, fmt.Errorf("%w: %s has no version tag", ErrInvalidImport, filepath.Base(path))
+	}
+
+	// The tag as written in the layout, e.g. with a "v" prefix
+	version := versions[len(versions)-1].Original()
+
+	slog.Info("Importing version", "version", version, "path", path)
+
+	return s.startJob(JobImport, version, func(ctx context.Context) error {
+		installed := false
+
+		err := s.update(ctx, layout, version, func() {
+			installed = true
+
+			if settle != nil {
+				settle(true)
+			}
+		})
+
+		if err != nil && !installed && settle != nil {
+			settle(false)
+		}
+
+		return err
+	})
+}
+
+// watchImports imports layouts dropped into the import directory, one at a
+// time. Layouts are moved to imported/ or failed/ once processed.
+func (s *Supervisor) watchImports(ctx context.Context) {
+	if s.config.ImportDir == "" {
+		return
+	}
+
+	ticker := time.NewTicker(importPollInterval)
+	defer ticker.Stop()
+
+	// Size and modification time seen in the previous scan, so layouts are
+	// only imported once they stopped changing
+	seen := map[string]string{}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.scanImports(seen)
+		}
+	}
+}
+
+func (s *Supervisor) scanImports(seen map[string]string) {
+	dir := s.config.ImportDir
+
+	entries, err := os.ReadDir(dir)
+
+	if err != nil {
+		slog.Warn("failed to read import directory", "dir", dir, "error", err)
+		return
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		path := filepath.Join(dir, name)
+
+		if strings.HasPrefix(name, ".") || name == importedDir || name == failedDir || !isLayout(path, entry) {
+			continue
+		}
+
+		fingerprint, err := layoutFingerprint(path)
+
+		if err != nil || seen[path] != fingerprint {
+			seen[path] = fingerprint
+			continue
+		}
+
+		_, err = s.startImport(path, func(installed bool) {
+			if installed {
+				moveImport(dir, path, importedDir)
+			} else {
+				moveImport(dir, path, failedDir)
+			}
+		})
+
+		if errors.Is(err, ErrBusy) {
+			// Try again with the next scan
+			return
+		}
+
+		delete(seen, path)
+
+		if err != nil {
+			slog.Error("failed to import", "path", path, "error", err)
+			moveImport(dir, path, failedDir)
+			continue
+		}
+
+		return
+	}
+}
+
+// isLayout reports whether an entry of the import directory looks like an
+// OCI image layout or a tar archive.
+func isLayout(path string, entry fs.DirEntry) bool {
+	if entry.IsDir() {
+		_, err := os.Stat(filepath.Join(path, "oci-layout"))
+		return err == nil
+	}
+
+	return entry.Type().IsRegular() && strings.HasSuffix(entry.Name(), ".tar")
+}
+
+// layoutFingerprint summarises the size and modification times of a layout,
+// to tell whether it is still being copied.
+func layoutFingerprint(path string) (string, error) {
+	var size int64
+	var latest time.Time
+
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		info, err := d.Info()
+
+		if err != nil {
+			return err
+		}
+
+		size += info.Size()
+
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+
+		return nil
+	})
+
+	return fmt.Sprintf("%d-%d", size, latest.UnixNano()), err
+}
+
+// moveImport moves a processed layout into a subdirectory of the import
+// directory, prefixed with the time so repeated drops don't collide.
+func moveImport(dir, path, sub string) {
+	target := filepath.Join(dir, sub, time.Now().Format("20060102-150405-")+filepath.Base(path))
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		slog.Error("failed to create directory for processed import", "error", err)
+		return
+	}
+
+	if err := os.Rename(path, target); err != nil {
+		slog.Error("failed to move processed import", "path", path, "error", err)
+	}
+}
@@ -0,0 +1,150 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+type JobKind string
+
+const (
+	JobUpdate   JobKind = "update"
+	JobRollback JobKind = "rollback"
+	JobRestart  JobKind = "restart"
+	JobImport   JobKind = "import"
+)
+
+type JobState string
+
+const (
+	JobRunning   JobState = "running"
+	JobSucceeded JobState = "succeeded"
+	JobFailed    JobState = "failed"
+)
+
+const maxJobs = 20
+
+var ErrBusy = errors.New("another job is already running")
+
+// ErrInvalidVersion is returned for versions that are not semver versions.
+var ErrInvalidVersion = errors.New("invalid version")
+
+type Job struct {
+	ID         string
+	Kind       JobKind
+	Version    string
+	State      JobState
+	Error      string
+	StartedAt  time.Time
+	FinishedAt time.Time
+	// BytesDone and BytesTotal are the download progress of update and
+	// import jobs.
+	BytesDone  int64
+	BytesTotal int64
+}
+
+// StartUpdate runs Update in the background and returns the job tracking it.
+func (s *Supervisor) StartUpdate(version string) (Job, error) {
+	if err := checkVersion(version); err != nil {
+		return Job{}, err
+	}
+
+	return s.startJob(JobUpdate, version, func(ctx context.Context) error {
+		return s.Update(ctx, version)
+	})
+}
+
+// StartRollback runs a rollback in the background. An empty version rolls
+// back to the most recent backup.
+func (s *Supervisor) StartRollback(version string) (Job, error) {
+	if version != "" {
+		if err := checkVersion(version); err != nil {
+			return Job{}, err
+		}
+	}
+
+	return s.startJob(JobRollback, version, func(ctx context.Context) error {
+		if version == "" {
+			return s.Rollback()
+		}
+
+		return s.RollbackTo(version)
+	})
+}
+
+// Jobs returns the most recent jobs, newest first.
+func (s *Supervisor) Jobs() []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]Job, len(s.jobs))
+
+	for i, job := range s.jobs {
+		jobs[len(s.jobs)-1-i] = *job
+	}
+
+	return jobs
+}
+
+// jobProgress records download progress on the running job for version.
+func (s *Supervisor) jobProgress(version string, done, total int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.activeJob == nil || s.activeJob.Version != version {
+		return
+	}
+
+	s.activeJob.BytesDone = done
+	s.activeJob.BytesTotal = total
+}
+
+func (s *Supervisor) startJob(kind JobKind, version string, run func(ctx context.Context) error) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.activeJob != nil {
+		return Job{}, ErrBusy
+	}
+
+	s.jobSeq++
+
+	job := &Job{
+		ID:        strconv.Itoa(s.jobSeq),
+		Kind:      kind,
+		Version:   version,
+		State:     JobRunning,
+		StartedAt: time.Now(),
+	}
+
+	s.activeJob = job
+	s.jobs = append(s.jobs, job)
+
+	if len(s.jobs) > maxJobs {
+		s.jobs = s.jobs[len(s.jobs)-maxJobs:]
+	}
+
+	go func() {
+		err := run(context.Background())
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		job.FinishedAt = time.Now()
+		job.State = JobSucceeded
+
+		if err != nil {
+			job.State = JobFailed
+			job.Error = err.Error()
+
+			slog.Error("job failed", "job", job.ID, "kind", kind, "version", version, "error", err)
+		}
+
+		s.activeJob = nil
+	}()
+
+	return *job, nil
+}
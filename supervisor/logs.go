@@ -0,0 +1,117 @@
+package supervisor
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+const logBufferSize = 1000
+
+type LogEntry struct {
+	Time    time.Time
+	Source  string
+	Level   string
+	Message string
+	Attrs   map[string]string
+}
+
+const (
+	LogSourceSupervisor = "supervisor"
+	LogSourceChild      = "child"
+)
+
+// Logs returns up to n of the most recent log entries, oldest first. Source
+// selects supervisor or captured child output, an empty source returns both.
+func (s *Supervisor) Logs(source string, n int) []LogEntry {
+	var entries []LogEntry
+
+	if source == "" || source == LogSourceSupervisor {
+		entries = append(entries, s.logs.Last(0)...)
+	}
+
+	if s.output.capturing() && (source == "" || source == LogSourceChild) {
+		entries = append(entries, s.output.tail.Last(0)...)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+
+	if n > 0 && n < len(entries) {
+		entries = entries[len(entries)-n:]
+	}
+
+	return entries
+}
+
+// captureLogs keeps recent supervisor logs around for the /logs endpoint by
+// wrapping the default slog handler.
+func (s *Supervisor) captureLogs() {
+	w, flags := log.Writer(), log.Flags()
+
+	slog.SetDefault(slog.New(newLogHandler(slog.Default().Handler(), s.logs)))
+
+	// SetDefault routes the log package into the new handler. The wrapped
+	// default handler writes through the log package itself, so restore its
+	// output to avoid a loop.
+	log.SetOutput(w)
+	log.SetFlags(flags)
+}
+
+// logHandler records every log record in the supervisor's ring buffer before
+// passing it on, so operators can read recent activity over IPC.
+type logHandler struct {
+	slog.Handler
+
+	logs  *ring[LogEntry]
+	attrs []slog.Attr
+}
+
+func newLogHandler(next slog.Handler, logs *ring[LogEntry]) *logHandler {
+	return &logHandler{
+		Handler: next,
+		logs:    logs,
+	}
+}
+
+func (h *logHandler) Handle(ctx context.Context, r slog.Record) error {
+	entry := LogEntry{
+		Time:    r.Time,
+		Source:  LogSourceSupervisor,
+		Level:   r.Level.String(),
+		Message: r.Message,
+		Attrs:   map[string]string{},
+	}
+
+	for _, a := range h.attrs {
+		entry.Attrs[a.Key] = a.Value.String()
+	}
+
+	r.Attrs(func(a slog.Attr) bool {
+		entry.Attrs[a.Key] = a.Value.String()
+		return true
+	})
+
+	h.logs.Push(entry)
+
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &logHandler{
+		Handler: h.Handler.WithAttrs(attrs),
+		logs:    h.logs,
+		attrs:   append(append([]slog.Attr{}, h.attrs...), attrs...),
+	}
+}
+
+func (h *logHandler) WithGroup(name string) slog.Handler {
+	return &logHandler{
+		Handler: h.Handler.WithGroup(name),
+		logs:    h.logs,
+		attrs:   h.attrs,
+	}
+}
@@ -0,0 +1,95 @@
+package supervisor
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/zeitlos/knockknock/source"
+)
+
+// metadataFetches bounds how many versions' metadata is fetched at once.
+const metadataFetches = 4
+
+// Metadata returns the metadata of a version offered by the update source.
+// Released versions are not expected to change, so it is cached.
+func (s *Supervisor) Metadata(ctx context.Context, version string) (*source.Metadata, error) {
+	if cached := s.cachedMetadata(version); cached != nil {
+		return cached, nil
+	}
+
+	metadata, err := s.source.Metadata(ctx, version)
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.metadata == nil {
+		s.metadata = map[string]*source.Metadata{}
+	}
+
+	s.metadata[version] = metadata
+
+	return metadata, nil
+}
+
+// Releases is ListVersions with the metadata of every version. Versions
+// whose metadata cannot be fetched are returned with just their version, as
+// are versions without cached metadata while the listing is stale.
+func (s *Supervisor) Releases(ctx context.Context) (VersionList, []source.Metadata, error) {
+	list, err := s.ListVersions(ctx)
+
+	if err != nil {
+		return list, nil, err
+	}
+
+	releases := make([]source.Metadata, len(list.Versions))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, metadataFetches)
+
+	for i, v := range list.Versions {
+		version := v.Original()
+		releases[i] = source.Metadata{Version: version}
+
+		if list.Stale {
+			if cached := s.cachedMetadata(version); cached != nil {
+				releases[i] = *cached
+			}
+
+			continue
+		}
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			metadata, err := s.Metadata(ctx, version)
+
+			if err != nil {
+				slog.Warn("failed to fetch version metadata", "version", version, "error", err)
+				return
+			}
+
+			releases[i] = *metadata
+		}()
+	}
+
+	wg.Wait()
+
+	return list, releases, nil
+}
+
+func (s *Supervisor) cachedMetadata(version string) *source.Metadata {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.metadata[version]
+}
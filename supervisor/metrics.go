@@ -0,0 +1,223 @@
+package supervisor
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// updateDurationBuckets are the upper bounds, in seconds, of the update
+// duration histogram.
+var updateDurationBuckets = []float64{1, 5, 10, 30, 60, 120, 300, 600}
+
+// metrics collects supervisor counters, rendered in the Prometheus text
+// exposition format by WriteMetrics.
+type metrics struct {
+	mu sync.Mutex
+
+	childStarts        int64
+	childExits         map[string]int64
+	childSignals       map[string]int64
+	crashLoopRollbacks int64
+	updateFailures     int64
+	downloadedBytes    int64
+
+	updateDurationCounts []int64
+	updateDurationSum    float64
+	updateDurationCount  int64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		childExits:           map[string]int64{},
+		childSignals:         map[string]int64{},
+		updateDurationCounts: make([]int64, len(updateDurationBuckets)),
+	}
+}
+
+func (m *metrics) childStarted() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.childStarts++
+}
+
+func (m *metrics) childExited(code int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.childExits[strconv.Itoa(code)]++
+}
+
+func (m *metrics) childSignaled(signal string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.childSignals[signal]++
+}
+
+func (m *metrics) crashLoopRolledBack() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.crashLoopRollbacks++
+}
+
+func (m *metrics) updateFailed() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.updateFailures++
+}
+
+func (m *metrics) updateSucceeded(duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	seconds := duration.Seconds()
+
+	for i, bound := range updateDurationBuckets {
+		if seconds <= bound {
+			m.updateDurationCounts[i]++
+		}
+	}
+
+	m.updateDurationSum += seconds
+	m.updateDurationCount++
+}
+
+func (m *metrics) downloaded(bytes int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.downloadedBytes += bytes
+}
+
+// WriteMetrics writes the supervisor metrics in the Prometheus text
+// exposition format.
+func (s *Supervisor) WriteMetrics(w io.Writer) error {
+	status := s.Status()
+
+	m := s.metrics
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+
+	writeMetric(&b, "knockknock_build_info", "gauge", "Version of the running binary.",
+		sample{labels: map[string]string{"version": status.Version.String()}, value: 1})
+
+	writeMetric(&b, "knockknock_start_time_seconds", "gauge", "Start time of the supervisor since unix epoch in seconds.",
+		sample{value: float64(status.StartedAt.Unix())})
+
+	up := 0.0
+	if status.ChildPID != 0 {
+		up = 1
+	}
+
+	writeMetric(&b, "knockknock_child_up", "gauge", "Whether the child process is running.",
+		sample{value: up})
+
+	// The first start is not a restart
+	writeMetric(&b, "knockknock_child_restarts_total", "counter", "Number of times the child process was restarted.",
+		sample{value: float64(max(m.childStarts-1, 0))})
+
+	writeMetric(&b, "knockknock_child_exits_total", "counter", "Number of child process exits by exit code.",
+		labeledSamples("code", m.childExits)...)
+
+	writeMetric(&b, "knockknock_child_signals_total", "counter", "Number of times the child process was killed by a signal.",
+		labeledSamples("signal", m.childSignals)...)
+
+	writeMetric(&b, "knockknock_crash_count", "gauge", "Crashes counted towards the crash-loop rollback.",
+		sample{value: float64(status.CrashCount)})
+
+	writeMetric(&b, "knockknock_crash_loop_rollbacks_total", "counter", "Number of rollbacks triggered by crash loops.",
+		sample{value: float64(m.crashLoopRollbacks)})
+
+	writeMetric(&b, "knockknock_update_failures_total", "counter", "Number of failed updates.",
+		sample{value: float64(m.updateFailures)})
+
+	writeMetric(&b, "knockknock_downloaded_bytes_total", "counter", "Bytes downloaded from the update source.",
+		sample{value: float64(m.downloadedBytes)})
+
+	fmt.Fprintf(&b, "# HELP knockknock_update_duration_seconds Duration of successful updates until restart.\n")
+	fmt.Fprintf(&b, "# TYPE knockknock_update_duration_seconds histogram\n")
+
+	for i, bound := range updateDurationBuckets {
+		fmt.Fprintf(&b, "knockknock_update_duration_seconds_bucket{le=\"%s\"} %d\n", formatFloat(bound), m.updateDurationCounts[i])
+	}
+
+	fmt.Fprintf(&b, "knockknock_update_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.updateDurationCount)
+	fmt.Fprintf(&b, "knockknock_update_duration_seconds_sum %s\n", formatFloat(m.updateDurationSum))
+	fmt.Fprintf(&b, "knockknock_update_duration_seconds_count %d\n", m.updateDurationCount)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+type sample struct {
+	labels map[string]string
+	value  float64
+}
+
+func labeledSamples(label string, values map[string]int64) []sample {
+	keys := make([]string, 0, len(values))
+
+	for k := range values {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	samples := make([]sample, len(keys))
+
+	for i, k := range keys {
+		samples[i] = sample{
+			labels: map[string]string{label: k},
+			value:  float64(values[k]),
+		}
+	}
+
+	return samples
+}
+
+func writeMetric(b *strings.Builder, name, kind, help string, samples ...sample) {
+	fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(b, "# TYPE %s %s\n", name, kind)
+
+	for _, s := range samples {
+		b.WriteString(name)
+
+		if len(s.labels) > 0 {
+			keys := make([]string, 0, len(s.labels))
+
+			for k := range s.labels {
+				keys = append(keys, k)
+			}
+
+			sort.Strings(keys)
+
+			pairs := make([]string, len(keys))
+
+			for i, k := range keys {
+				pairs[i] = fmt.Sprintf("%s=\"%s\"", k, escapeLabel(s.labels[k]))
+			}
+
+			fmt.Fprintf(b, "{%s}", strings.Join(pairs, ","))
+		}
+
+		fmt.Fprintf(b, " %s\n", formatFloat(s.value))
+	}
+}
+
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,220 @@
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Environment variables of the systemd notification protocol, see
+// sd_notify(3).
+const (
+	notifySocketEnv = "NOTIFY_SOCKET"
+	watchdogUsecEnv = "WATCHDOG_USEC"
+	watchdogPIDEnv  = "WATCHDOG_PID"
+)
+
+// notifier speaks the sd_notify datagram protocol to the service manager. A
+// nil notifier discards all messages, so callers do not need to check whether
+// the supervisor runs under systemd.
+type notifier struct {
+	conn net.Conn
+	// watchdog is the service manager's watchdog timeout, zero if disabled.
+	watchdog time.Duration
+
+	mu        sync.Mutex
+	ready     bool
+	reloading bool
+}
+
+// newNotifier connects to the notification socket at addr. Addresses
+// starting with '@' are in the abstract namespace.
+func newNotifier(addr string, watchdog time.Duration) (*notifier, error) {
+	conn, err := net.Dial("unixgram", addr)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to notify socket: %w", err)
+	}
+
+	return &notifier{conn: conn, watchdog: watchdog}, nil
+}
+
+// notifierFromEnv returns a notifier for $NOTIFY_SOCKET, or nil if the
+// supervisor is not run by a service manager that wants notifications.
+func notifierFromEnv() *notifier {
+	addr := os.Getenv(notifySocketEnv)
+
+	if addr == "" {
+		return nil
+	}
+
+	var watchdog time.Duration
+
+	if usec, err := strconv.ParseInt(os.Getenv(watchdogUsecEnv), 10, 64); err == nil && usec > 0 {
+		pid := os.Getenv(watchdogPIDEnv)
+
+		if pid == "" || pid == strconv.Itoa(os.Getpid()) {
+			watchdog = time.Duration(usec) * time.Microsecond
+		}
+	}
+
+	n, err := newNotifier(addr, watchdog)
+
+	if err != nil {
+		slog.Warn("systemd notifications disabled", "error", err)
+		return nil
+	}
+
+	return n
+}
+
+func (n *notifier) send(state ...string) {
+	if n == nil {
+		return
+	}
+
+	if _, err := n.conn.Write([]byte(strings.Join(state, "\n"))); err != nil {
+		slog.Warn("failed to notify service manager", "state", state, "error", err)
+	}
+}
+
+// Ready reports the service as started. Only the first call sends READY=1,
+// later ones only update the status.
+func (n *notifier) Ready(status string) {
+	if n == nil {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.ready {
+		n.send("STATUS=" + status)
+		return
+	}
+
+	n.ready = true
+	n.send("READY=1", "STATUS="+status)
+}
+
+func (n *notifier) Status(status string) {
+	n.send("STATUS=" + status)
+}
+
+// Reloading reports that the service is updating itself. It ends with
+// Reloaded, or Stopping when the supervisor restarts. Before the service is
+// ready only the status is sent.
+func (n *notifier) Reloading(status string) {
+	if n == nil {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if !n.ready {
+		n.send("STATUS=" + status)
+		return
+	}
+
+	n.reloading = true
+
+	state := []string{"RELOADING=1", "STATUS=" + status}
+
+	// systemd only requires the timestamp from Type=notify-reload services
+	if usec, err := monotonicUsec(); err == nil {
+		state = append(state, fmt.Sprintf("MONOTONIC_USEC=%d", usec))
+	} else {
+		slog.Warn("failed to read monotonic clock", "error", err)
+	}
+
+	n.send(state...)
+}
+
+// Reloaded ends a reload that did not restart the supervisor.
+func (n *notifier) Reloaded(status string) {
+	if n == nil {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if !n.reloading {
+		n.send("STATUS=" + status)
+		return
+	}
+
+	n.reloading = false
+	n.send("READY=1", "STATUS="+status)
+}
+
+func (n *notifier) Stopping(status string) {
+	n.send("STOPPING=1", "STATUS="+status)
+}
+
+func (n *notifier) Watchdog() {
+	n.send("WATCHDOG=1")
+}
+
+func (n *notifier) Close() error {
+	if n == nil {
+		return nil
+	}
+
+	return n.conn.Close()
+}
+
+// statusLine formats the STATUS= text for the current version and phase. It
+// must not be called with s.mu held.
+func (s *Supervisor) statusLine(phase string) string {
+	return fmt.Sprintf("%s %s: %s", s.config.BinaryName, s.CurrentVersion(), phase)
+}
+
+// pingWatchdog keeps the service manager's watchdog satisfied for as long as
+// the child is healthy, which with the knockknock watchdog enabled means
+// that its heartbeats arrive.
+func (s *Supervisor) pingWatchdog(ctx context.Context) {
+	if s.notify == nil || s.notify.watchdog == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.notify.watchdog / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if s.childHealthy() {
+			s.notify.Watchdog()
+		}
+	}
+}
+
+// childEnv returns the child's environment. The notification variables are
+// meant for the supervisor only.
+func (s *Supervisor) childEnv() []string {
+	var env []string
+
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+
+		if name == notifySocketEnv || name == watchdogUsecEnv || name == watchdogPIDEnv {
+			continue
+		}
+
+		env = append(env, kv)
+	}
+
+	return append(env, fmt.Sprintf("%s=%s", socketEnv, s.socketPath))
+}
@@ -0,0 +1,24 @@
+package supervisor
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// monotonicUsec returns CLOCK_MONOTONIC in microseconds, which systemd uses
+// to order RELOADING=1 against its own reload requests.
+func monotonicUsec() (int64, error) {
+	const clockMonotonic = 1
+
+	var ts syscall.Timespec
+
+	_, _, errno := syscall.Syscall(syscall.SYS_CLOCK_GETTIME, clockMonotonic, uintptr(unsafe.Pointer(&ts)), 0)
+
+	if errno != 0 {
+		return 0, fmt.Errorf("clock_gettime failed: %w", errno)
+	}
+
+	return ts.Nano() / int64(time.Microsecond), nil
+}
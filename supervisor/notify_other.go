@@ -0,0 +1,10 @@
+//go:build !linux
+
+package supervisor
+
+import "errors"
+
+// monotonicUsec is only needed for systemd, which only runs on Linux.
+func monotonicUsec() (int64, error) {
+	return 0, errors.New("monotonic clock not supported on this platform")
+}
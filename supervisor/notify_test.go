@@ -0,0 +1,163 @@
+package supervisor
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// listenNotify starts a unixgram listener standing in for the service
+// manager and points NOTIFY_SOCKET at it.
+func listenNotify(t *testing.T) *net.UnixConn {
+	t.Helper()
+
+	// Socket paths are limited to about 100 bytes, too short for t.TempDir
+	dir, err := os.MkdirTemp("", "kk-notify-")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	addr := filepath.Join(dir, "notify.sock")
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: addr, Net: "unixgram"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	t.Setenv(notifySocketEnv, addr)
+
+	return conn
+}
+
+func readNotify(t *testing.T, conn *net.UnixConn) []string {
+	t.Helper()
+
+	buf := make([]byte, 4096)
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	n, err := conn.Read(buf)
+
+	if err != nil {
+		t.Fatalf("no notification received: %v", err)
+	}
+
+	return strings.Split(string(buf[:n]), "\n")
+}
+
+func TestNotifierProtocol(t *testing.T) {
+	conn := listenNotify(t)
+
+	n := notifierFromEnv()
+
+	if n == nil {
+		t.Fatal("expected a notifier for NOTIFY_SOCKET")
+	}
+	defer n.Close()
+
+	// Reloading before READY=1 only updates the status
+	n.Reloading("updating")
+
+	if got := readNotify(t, conn); len(got) != 1 || got[0] != "STATUS=updating" {
+		t.Fatalf("unexpected message before ready: %q", got)
+	}
+
+	n.Ready("running")
+
+	if got := readNotify(t, conn); len(got) != 2 || got[0] != "READY=1" || got[1] != "STATUS=running" {
+		t.Fatalf("unexpected ready message: %q", got)
+	}
+
+	n.Ready("still running")
+
+	if got := readNotify(t, conn); len(got) != 1 || got[0] != "STATUS=still running" {
+		t.Fatalf("READY=1 sent twice: %q", got)
+	}
+
+	n.Reloading("updating")
+
+	got := readNotify(t, conn)
+
+	if len(got) < 2 || got[0] != "RELOADING=1" || got[1] != "STATUS=updating" {
+		t.Fatalf("unexpected reloading message: %q", got)
+	}
+
+	if _, err := monotonicUsec(); err == nil {
+		if len(got) != 3 || !strings.HasPrefix(got[2], "MONOTONIC_USEC=") {
+			t.Fatalf("missing MONOTONIC_USEC: %q", got)
+		}
+
+		if usec, err := strconv.ParseInt(strings.TrimPrefix(got[2], "MONOTONIC_USEC="), 10, 64); err != nil || usec <= 0 {
+			t.Fatalf("invalid MONOTONIC_USEC: %q", got[2])
+		}
+	}
+
+	n.Reloaded("running")
+
+	if got := readNotify(t, conn); len(got) != 2 || got[0] != "READY=1" {
+		t.Fatalf("unexpected reloaded message: %q", got)
+	}
+
+	n.Watchdog()
+
+	if got := readNotify(t, conn); len(got) != 1 || got[0] != "WATCHDOG=1" {
+		t.Fatalf("unexpected watchdog message: %q", got)
+	}
+
+	n.Stopping("restarting")
+
+	if got := readNotify(t, conn); len(got) != 2 || got[0] != "STOPPING=1" {
+		t.Fatalf("unexpected stopping message: %q", got)
+	}
+}
+
+func TestNotifierWatchdogFromEnv(t *testing.T) {
+	listenNotify(t)
+
+	t.Setenv(watchdogUsecEnv, "2000000")
+	t.Setenv(watchdogPIDEnv, strconv.Itoa(os.Getpid()))
+
+	n := notifierFromEnv()
+	defer n.Close()
+
+	if n.watchdog != 2*time.Second {
+		t.Fatalf("expected a 2s watchdog, got %s", n.watchdog)
+	}
+
+	// The watchdog belongs to another process, e.g. a parent shell
+	t.Setenv(watchdogPIDEnv, "1")
+
+	other := notifierFromEnv()
+	defer other.Close()
+
+	if other.watchdog != 0 {
+		t.Fatalf("expected the watchdog to be ignored, got %s", other.watchdog)
+	}
+}
+
+func TestNotifierWithoutSocket(t *testing.T) {
+	t.Setenv(notifySocketEnv, "")
+
+	n := notifierFromEnv()
+
+	if n != nil {
+		t.Fatal("expected no notifier without NOTIFY_SOCKET")
+	}
+
+	// A nil notifier discards everything
+	n.Ready("running")
+	n.Reloading("updating")
+	n.Watchdog()
+
+	if err := n.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,266 @@
+package supervisor
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/zeitlos/knockknock/config"
+)
+
+// Defaults for zero fields of config.LogCaptureConfig.
+const (
+	defaultLogMaxSize   = 10 << 20
+	defaultLogMaxFiles  = 5
+	defaultLogTailLines = 200
+)
+
+// childOutput captures the child's stdout and stderr. Output is passed
+// through to the supervisor's own streams, written to a rotated log file
+// tagged with version and PID, and kept in an in-memory tail. Stderr is
+// always kept for crash reports, everything else only with log capture.
+type childOutput struct {
+	file   *rotatingFile
+	tail   *ring[LogEntry]
+	stderr *ring[LogEntry]
+}
+
+func newOutput(basePath string, config *config.Config) *childOutput {
+	output := &childOutput{
+		stderr: newRing[LogEntry](crashTraceLines),
+	}
+
+	if capture := config.LogCapture; capture != nil {
+		dir := capture.Dir
+
+		if dir == "" {
+			dir = filepath.Join(basePath, "logs")
+		}
+
+		output.file = &rotatingFile{
+			path:     filepath.Join(dir, "child.log"),
+			maxSize:  cmp.Or(capture.MaxSize, defaultLogMaxSize),
+			maxFiles: cmp.Or(capture.MaxFiles, defaultLogMaxFiles),
+		}
+		output.tail = newRing[LogEntry](cmp.Or(capture.TailLines, defaultLogTailLines))
+	}
+
+	return output
+}
+
+// Close closes the log file. It is reopened if the child writes again.
+func (o *childOutput) Close() error {
+	if o.file == nil {
+		return nil
+	}
+
+	return o.file.Close()
+}
+
+// capturing reports whether all output is captured, not only stderr.
+func (o *childOutput) capturing() bool {
+	return o.tail != nil
+}
+
+// capture copies the child's output streams until they are closed. A nil
+// stdout is not captured. The returned function waits for copying to finish
+// and must be called before cmd.Wait.
+func (o *childOutput) capture(version string, pid int, stdout, stderr io.Reader) func() {
+	var wg sync.WaitGroup
+
+	for _, stream := range []struct {
+		name        string
+		r           io.Reader
+		passthrough io.Writer
+	}{
+		{"stdout", stdout, os.Stdout},
+		{"stderr", stderr, os.Stderr},
+	} {
+		if stream.r == nil {
+			continue
+		}
+
+		w := o.writer(stream.name, stream.passthrough, version, pid)
+
+		wg.Go(func() {
+			io.Copy(w, stream.r)
+			w.Flush()
+		})
+	}
+
+	return wg.Wait
+}
+
+// stderrLines returns up to n of the most recent stderr lines of the child with
+// the given PID.
+func (o *childOutput) stderrLines(pid int, n int) []string {
+	var lines []string
+
+	for _, entry := range o.stderr.Last(0) {
+		if entry.Attrs["pid"] == strconv.Itoa(pid) {
+			lines = append(lines, entry.Message)
+		}
+	}
+
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+
+	return lines
+}
+
+func (o *childOutput) writer(stream string, passthrough io.Writer, version string, pid int) *lineWriter {
+	return &lineWriter{
+		passthrough: passthrough,
+		line: func(line string) {
+			now := time.Now()
+
+			entry := LogEntry{
+				Time:    now,
+				Source:  LogSourceChild,
+				Message: line,
+				Attrs: map[string]string{
+					"stream":  stream,
+					"version": version,
+					"pid":     strconv.Itoa(pid),
+				},
+			}
+
+			if stream == "stderr" {
+				o.stderr.Push(entry)
+			}
+
+			if o.capturing() {
+				fmt.Fprintf(o.file, "%s %s %d %s %s\n", now.UTC().Format(time.RFC3339Nano), version, pid, stream, line)
+				o.tail.Push(entry)
+			}
+		},
+	}
+}
+
+// lineWriter passes writes through and reports every complete line.
+type lineWriter struct {
+	passthrough io.Writer
+	line        func(string)
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.passthrough.Write(p)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+
+		if i < 0 {
+			break
+		}
+
+		w.line(string(bytes.TrimRight(w.buf[:i], "\r")))
+		w.buf = w.buf[i+1:]
+	}
+
+	return len(p), nil
+}
+
+// Flush reports a trailing line without newline.
+func (w *lineWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.buf) > 0 {
+		w.line(string(w.buf))
+		w.buf = nil
+	}
+}
+
+// rotatingFile appends to path and rotates it to path.1, path.2, ... once it
+// grows beyond maxSize.
+type rotatingFile struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file != nil && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		f.file.Close()
+		f.file = nil
+
+		f.rotate()
+	}
+
+	if f.file == nil {
+		if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+			return 0, fmt.Errorf("failed to create log directory: %w", err)
+		}
+
+		file, err := os.OpenFile(f.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+
+		if err != nil {
+			return 0, fmt.Errorf("failed to open log file: %w", err)
+		}
+
+		info, err := file.Stat()
+
+		if err != nil {
+			file.Close()
+			return 0, fmt.Errorf("failed to stat log file: %w", err)
+		}
+
+		f.file = file
+		f.size = info.Size()
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+
+	return n, err
+}
+
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+
+	err := f.file.Close()
+	f.file = nil
+
+	return err
+}
+
+func (f *rotatingFile) rotate() {
+	os.Remove(fmt.Sprintf("%s.%d", f.path, f.maxFiles))
+
+	for i := f.maxFiles - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1))
+	}
+
+	if f.maxFiles > 0 {
+		os.Rename(f.path, f.path+".1")
+	} else {
+		os.Remove(f.path)
+	}
+}
@@ -0,0 +1,73 @@
+package supervisor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zeitlos/knockknock/config"
+)
+
+func TestOutputDefaults(t *testing.T) {
+	dir := t.TempDir()
+
+	// A literal config, without WithLogCapture filling in defaults
+	cfg := config.New("app")
+	cfg.LogCapture = &config.LogCaptureConfig{Dir: dir}
+
+	output := newOutput(t.TempDir(), cfg)
+
+	if output.file.maxSize != defaultLogMaxSize || output.file.maxFiles != defaultLogMaxFiles {
+		t.Fatalf("expected default rotation, got %d bytes and %d files", output.file.maxSize, output.file.maxFiles)
+	}
+
+	wait := output.capture("1.0.0", 42, strings.NewReader("one\ntwo\nthree\n"), strings.NewReader(""))
+	wait()
+
+	if got := output.tail.Last(0); len(got) != 3 {
+		t.Fatalf("expected 3 lines in the tail, got %d", len(got))
+	}
+
+	// Every line went into the same file, none was rotated away
+	if _, err := os.Stat(filepath.Join(dir, "child.log.1")); !os.IsNotExist(err) {
+		t.Fatalf("expected no rotation, got %v", err)
+	}
+
+	if err := output.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if output.file.file != nil {
+		t.Fatal("expected the log file to be closed")
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "child.log"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := strings.Count(string(data), "\n"); n != 3 {
+		t.Fatalf("expected 3 lines in the log file, got %d", n)
+	}
+}
+
+func TestOutputWithoutCapture(t *testing.T) {
+	output := newOutput(t.TempDir(), config.New("app"))
+
+	if output.capturing() {
+		t.Fatal("expected only stderr to be kept")
+	}
+
+	wait := output.capture("1.0.0", 42, nil, strings.NewReader("panic: boom\n"))
+	wait()
+
+	if got := output.stderrLines(42, 10); len(got) != 1 || got[0] != "panic: boom" {
+		t.Fatalf("unexpected stderr %q", got)
+	}
+
+	if err := output.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,82 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"syscall"
+
+	"github.com/zeitlos/knockknock/config"
+)
+
+// Exit codes reserved for the child to tell the supervisor what to do next.
+// Exits with these codes are not counted as crashes.
+const (
+	// ExitRestart starts the child again.
+	ExitRestart = 90
+	// ExitStop stops the supervisor, which exits with 0.
+	ExitStop = 91
+	// ExitRollback rolls back to the previous version.
+	ExitRollback = 92
+)
+
+var ErrNoChild = errors.New("no child process is running")
+
+// StartRestart restarts the child in the background. The child is drained
+// first and then terminated, the supervisor keeps running.
+func (s *Supervisor) StartRestart(reason string) (Job, error) {
+	if s.currentChildPID() == 0 {
+		return Job{}, ErrNoChild
+	}
+
+	return s.startJob(JobRestart, s.CurrentVersion().String(), func(ctx context.Context) error {
+		return s.RestartChild(reason)
+	})
+}
+
+// RestartChild drains and terminates the child so that Run starts it again.
+// The exit is not counted as a crash.
+func (s *Supervisor) RestartChild(reason string) error {
+	if s.currentChildPID() == 0 {
+		return ErrNoChild
+	}
+
+	slog.Info("restarting child", "reason", reason)
+
+	s.drain(config.RestartRestart, s.CurrentVersion().String(), reason)
+
+	s.mu.Lock()
+	pid := s.childPID
+	s.restartRequested = pid != 0
+	s.mu.Unlock()
+
+	if pid == 0 {
+		return ErrNoChild
+	}
+
+	if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
+		return fmt.Errorf("failed to terminate child: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Supervisor) currentChildPID() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.childPID
+}
+
+// takeRestartRequest reports whether the last child exit was requested
+// through RestartChild, and clears the request.
+func (s *Supervisor) takeRestartRequest() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	requested := s.restartRequested
+	s.restartRequested = false
+
+	return requested
+}
@@ -0,0 +1,51 @@
+package supervisor
+
+import "sync"
+
+// ring keeps the last N items pushed into it.
+type ring[T any] struct {
+	mu    sync.Mutex
+	items []T
+	next  int
+	full  bool
+}
+
+func newRing[T any](size int) *ring[T] {
+	return &ring[T]{items: make([]T, size)}
+}
+
+func (r *ring[T]) Push(item T) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.items) == 0 {
+		return
+	}
+
+	r.items[r.next] = item
+	r.next = (r.next + 1) % len(r.items)
+
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// Last returns up to n of the most recent items, oldest first. A n <= 0
+// returns everything that is buffered.
+func (r *ring[T]) Last(n int) []T {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var all []T
+
+	if r.full {
+		all = append(all, r.items[r.next:]...)
+	}
+	all = append(all, r.items[:r.next]...)
+
+	if n > 0 && n < len(all) {
+		all = all[len(all)-n:]
+	}
+
+	return all
+}
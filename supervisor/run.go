@@ -1,82 +1,284 @@
 package supervisor
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"os/exec"
 	"syscall"
 	"time"
+
+	"github.com/zeitlos/knockknock/config"
 )
 
 func (s *Supervisor) Run() {
-	socketPath := SocketPath()
-	crashCount := 0
+	os.Exit(s.RunContext(context.Background()))
+}
+
+// RunContext supervises the child until the restart policy lets it stay
+// down or ctx is cancelled, and returns the code the supervisor should exit
+// with.
+func (s *Supervisor) RunContext(ctx context.Context) int {
+	s.captureLogs()
+	defer s.output.Close()
+
+	s.notify.Status(s.statusLine("starting"))
+	defer s.notify.Stopping(s.statusLine("stopping"))
+
+	go s.pingWatchdog(ctx)
+	go s.watchImports(ctx)
+	go s.checkUpdates(ctx)
+
 	resetWindow := time.NewTicker(5 * time.Minute)
+	defer resetWindow.Stop()
 
 	for {
 		select {
+		case <-ctx.Done():
+			return 0
 		case <-resetWindow.C:
-			crashCount = 0 // Reset crash counter periodically
+			s.setCrashCount(0) // Reset crash counter periodically
 		default:
 		}
 
 		// Launch child process
-		cmd := exec.Command(os.Args[0], os.Args[1:]...)
-		cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%s", socketEnv, socketPath))
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+		command := s.childCommand()
+
+		cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+		cmd.Env = s.childEnv()
 		cmd.Stdin = os.Stdin
 
+		var stdout io.ReadCloser
+
+		if s.output.capturing() {
+			stdout, _ = cmd.StdoutPipe()
+		} else {
+			cmd.Stdout = os.Stdout
+		}
+
+		stderr, _ := cmd.StderrPipe()
+
+		oomBefore := oomKills()
+
+		// Armed before the start, the child may say hello right away
+		hello := s.expectHello()
+
+		s.spawnMu.Lock()
+
 		if err := cmd.Start(); err != nil {
-			panic(err)
+			s.spawnMu.Unlock()
+			slog.Error("failed to start child", "command", command, "error", err)
+			return 1
+		}
+
+		pid := cmd.Process.Pid
+		startedAt := time.Now()
+
+		s.setChildPID(pid)
+		s.spawnMu.Unlock()
+
+		s.metrics.childStarted()
+
+		exited := make(chan struct{})
+
+		if s.config.StartupTimeout > 0 {
+			go s.watchStartup(pid, hello, exited)
 		}
 
-		exitCode := 0
+		if s.config.WatchdogTimeout > 0 {
+			go s.watchHeartbeats(pid, hello, exited)
+		}
+
+		wait := s.output.capture(s.CurrentVersion().String(), pid, stdout, stderr)
+		wait()
+
+		exit := crashExit{pid: pid, startedAt: startedAt}
 
 		// Wait for child to exit
-		if err := cmd.Wait(); err != nil {
-			if exitErr, ok := err.(*exec.ExitError); ok {
-				if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
-					exitCode = status.ExitStatus()
-
-					// Check if killed by signal (segfault, etc.)
-					if status.Signaled() {
-						crashCount++
+		err := cmd.Wait()
+		close(exited)
+
+		intentional := s.takeRestartRequest()
+		exit.startupTimeout, exit.watchdogTimeout = s.childExited()
+
+		if err == nil {
+			s.metrics.childExited(0)
+		} else if exitErr, ok := err.(*exec.ExitError); ok {
+			if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+				exit.exitCode = status.ExitStatus()
+
+				// Check if killed by signal (segfault, etc.)
+				if status.Signaled() {
+					exit.signal = status.Signal()
+					s.metrics.childSignaled(exit.signal.String())
+
+					// Counted as a crash by handleCrash
+					if !intentional {
 						slog.Error("Child killed by signal", "signal", status.Signal())
 					}
+				} else {
+					s.metrics.childExited(exit.exitCode)
 				}
 			}
+		} else {
+			// The child's status is unknown, or it exited but waiting for it
+			// failed. Counted as a crash rather than a clean exit.
+			slog.Error("Failed to wait for child", "pid", pid, "error", err)
+
+			exit.exitCode = 1
+
+			if state := cmd.ProcessState; state != nil && state.ExitCode() > 0 {
+				exit.exitCode = state.ExitCode()
+			}
+
+			s.metrics.childExited(exit.exitCode)
 		}
 
-		if exitCode == 0 {
-			os.Exit(0)
+		s.setChildPID(0)
+
+		if ctx.Err() != nil {
+			return 0
 		}
 
-		crashCount++
-		slog.Error("Child exited", "code", exitCode, "crashCount", crashCount)
+		// Exits caused by the startup deadline or the watchdog are always
+		// crashes, whatever code the child exited with
+		selfExit := exit.signal == 0 && !exit.forced()
 
-		if crashCount >= 3 {
-			slog.Error("Too many crashes, initiating rollback")
+		switch {
+		case (intentional && !exit.forced()) || (selfExit && exit.exitCode == ExitRestart):
+			slog.Info("Restarting child on request", "code", exit.exitCode)
+		case selfExit && exit.exitCode == ExitStop:
+			slog.Info("Child requested stop")
+			return 0
+		case selfExit && exit.exitCode == ExitRollback:
+			slog.Info("Child requested rollback")
 
 			if err := s.Rollback(); err != nil {
 				slog.Error("Rollback failed", "error", err)
 			}
+		case selfExit && exit.exitCode == 0:
+			if !s.shouldRestart(true) {
+				return 0
+			}
+
+			slog.Info("Child exited cleanly, restarting", "policy", s.config.RestartPolicy)
+		default:
+			if exit.signal == syscall.SIGKILL && oomBefore >= 0 && oomKills() > oomBefore {
+				exit.oomKilled = true
+			}
 
-			crashCount = 0
+			s.handleCrash(exit)
+
+			if !s.shouldRestart(false) {
+				slog.Error("Child failed, not restarting", "policy", s.config.RestartPolicy)
+				return exit.status()
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return 0
+		case <-time.After(s.config.RestartDelay):
 		}
+	}
+}
+
+// shouldRestart applies the restart policy to an exit the child did not
+// request through a reserved exit code or RestartChild.
+func (s *Supervisor) shouldRestart(clean bool) bool {
+	switch s.config.RestartPolicy {
+	case config.RestartAlways:
+		return true
+	case config.RestartNever:
+		return false
+	default:
+		return !clean
+	}
+}
+
+func validRestartPolicy(policy config.RestartPolicy) bool {
+	switch policy {
+	case "", config.RestartAlways, config.RestartOnFailure, config.RestartNever:
+		return true
+	default:
+		return false
+	}
+}
+
+// handleCrash records a crash and rolls back once the child crashed too
+// often.
+func (s *Supervisor) handleCrash(exit crashExit) {
+	report := s.recordCrash(exit)
+
+	s.notify.Status(s.statusLine(fmt.Sprintf("child crashed (%s)", report.Class)))
+
+	crashCount := s.addCrash()
+	slog.Error("Child exited", "code", exit.exitCode, "class", report.Class, "report", report.ID, "crashCount", crashCount)
+
+	if crashCount < 3 {
+		return
+	}
 
-		time.Sleep(1 * time.Second)
+	slog.Error("Too many crashes, initiating rollback")
+
+	s.metrics.crashLoopRolledBack()
+
+	s.publish(Event{
+		Type:    EventCrashLoopDetected,
+		Version: s.CurrentVersion().String(),
+		Message: fmt.Sprintf("child crashed %d times", crashCount),
+	})
+
+	if err := s.Rollback(); err != nil {
+		slog.Error("Rollback failed", "error", err)
 	}
+
+	s.setCrashCount(0)
+}
+
+func (s *Supervisor) childCommand() []string {
+	if len(s.config.Command) > 0 {
+		return s.config.Command
+	}
+
+	return os.Args
+}
+
+func (s *Supervisor) setChildPID(pid int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.childPID = pid
+}
+
+func (s *Supervisor) addCrash() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.crashCount++
+
+	return s.crashCount
+}
+
+func (s *Supervisor) setCrashCount(count int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.crashCount = count
 }
 
 func IsSupervisorProcess() bool {
 	return os.Getenv(socketEnv) == ""
 }
 
-func SocketPath() string {
+// SocketPath returns the IPC socket address for the current process. The
+// supervisor resolves it from the config, the child inherits it through the
+// environment.
+func SocketPath(config *config.Config) string {
 	if IsSupervisorProcess() {
-		return fmt.Sprintf("/tmp/knockknock-%d.sock", os.Getpid())
+		return config.ResolveSocketPath()
 	}
 
 	return os.Getenv(socketEnv)
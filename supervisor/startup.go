@@ -0,0 +1,95 @@
+package supervisor
+
+import (
+	"log/slog"
+	"syscall"
+	"time"
+)
+
+// Hello registers the running child as started. It reports whether pid is
+// the current child and was waiting to be registered.
+func (s *Supervisor) Hello(pid int, version string) bool {
+	// Wait until a child that is being started has its pid registered
+	s.spawnMu.Lock()
+	s.spawnMu.Unlock()
+
+	s.mu.Lock()
+
+	if child := s.childPID; child == 0 || child != pid || s.hello == nil {
+		s.mu.Unlock()
+		slog.Warn("ignoring hello", "pid", pid, "child", child)
+		return false
+	}
+
+	close(s.hello)
+	s.hello = nil
+	s.childReady = true
+	s.lastHeartbeat = time.Now()
+
+	s.mu.Unlock()
+
+	slog.Info("child started", "pid", pid, "version", version)
+
+	s.notify.Ready(s.statusLine("running"))
+
+	return true
+}
+
+// expectHello prepares for the hello of a newly started child and returns a
+// channel that is closed once it arrives.
+func (s *Supervisor) expectHello() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hello := make(chan struct{})
+
+	s.hello = hello
+	s.childReady = false
+	s.startupFailed = false
+	s.watchdogFired = false
+
+	return hello
+}
+
+// watchStartup kills the child if it does not say hello within the startup
+// timeout. It returns once the hello arrived or the child exited.
+func (s *Supervisor) watchStartup(pid int, hello <-chan struct{}, exited <-chan struct{}) {
+	timeout := s.config.StartupTimeout
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-hello:
+		return
+	case <-exited:
+		return
+	case <-timer.C:
+	}
+
+	s.mu.Lock()
+	s.startupFailed = true
+	s.mu.Unlock()
+
+	slog.Error("child did not start in time, killing it", "pid", pid, "timeout", timeout)
+
+	if err := syscall.Kill(pid, syscall.SIGKILL); err != nil {
+		slog.Error("failed to kill child", "pid", pid, "error", err)
+	}
+}
+
+// childExited resets the startup state after the child exited and reports
+// whether it was killed for not starting in time or by the watchdog.
+func (s *Supervisor) childExited() (startupFailed, watchdogFired bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	startupFailed, watchdogFired = s.startupFailed, s.watchdogFired
+
+	s.hello = nil
+	s.childReady = false
+	s.startupFailed = false
+	s.watchdogFired = false
+
+	return startupFailed, watchdogFired
+}
@@ -0,0 +1,36 @@
+package supervisor
+
+import (
+	"testing"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/zeitlos/knockknock/config"
+)
+
+func TestHelloMatchesChildPID(t *testing.T) {
+	s := &Supervisor{
+		config:         config.New("app"),
+		currentVersion: semver.MustParse("1.0.0"),
+	}
+
+	hello := s.expectHello()
+	s.setChildPID(42)
+
+	if s.Hello(41, "1.0.0") {
+		t.Fatal("accepted a hello from a stale child")
+	}
+
+	if !s.Hello(42, "1.0.0") {
+		t.Fatal("rejected the hello of the current child")
+	}
+
+	select {
+	case <-hello:
+	default:
+		t.Fatal("hello channel not closed")
+	}
+
+	if s.Hello(42, "1.0.0") {
+		t.Fatal("accepted a second hello")
+	}
+}
@@ -8,21 +8,73 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/Masterminds/semver/v3"
 	"github.com/zeitlos/knockknock/config"
+	"github.com/zeitlos/knockknock/internal/testhook"
 	"github.com/zeitlos/knockknock/oras"
+	"github.com/zeitlos/knockknock/source"
 )
 
 type Supervisor struct {
-	oras oras.Client
+	source source.UpdateSource
 
 	currentVersion *semver.Version
 	config         *config.Config
 	basePath       string
 	socketPath     string
+	startedAt      time.Time
+	logs           *ring[LogEntry]
+	events         events
+	metrics        *metrics
+	output         *childOutput
+	notify         *notifier
+	// restartFunc replaces terminating the process after an update or
+	// rollback, see testhook.SetRestartFunc
+	restartFunc func(version string) error
+
+	// spawnMu is held while a child is started until its pid is known, so
+	// its hello can be told apart from that of the previous child
+	spawnMu sync.Mutex
+
+	mu         sync.Mutex
+	childPID   int
+	crashCount int
+	jobs       []*Job
+	activeJob  *Job
+	jobSeq     int
+	announced  *semver.Version
+	metadata   map[string]*source.Metadata
+
+	// versionsMu serialises listing the source, so concurrent callers share
+	// one refresh of versionCache
+	versionsMu   sync.Mutex
+	versionCache *versionCache
+	drainAck     chan struct{}
+	lastCrash    *CrashReport
+
+	restartRequested bool
+	hello            chan struct{}
+	childReady       bool
+	startupFailed    bool
+	lastHeartbeat    time.Time
+	watchdogFired    bool
+}
+
+type Status struct {
+	Version    semver.Version
+	PID        int
+	ChildPID   int
+	ChildReady bool
+	StartedAt  time.Time
+	SocketPath string
+	BasePath   string
+	CrashCount int
+	ActiveJob  *Job
+	LastCrash  *CrashReport
 }
 
 type HistoricVersion struct {
@@ -37,64 +89,219 @@ func New(config *config.Config) (*Supervisor, error) {
 		return nil, fmt.Errorf("binary name is required")
 	}
 
-	if config.Repo == "" {
-		return nil, fmt.Errorf("repo is required")
+	if config.Repo == "" && config.Source == nil && !config.DevMode {
+		return nil, fmt.Errorf("repo or source is required")
 	}
 
 	if config.Version == "" {
 		return nil, fmt.Errorf("version is required")
 	}
 
+	if !validRestartPolicy(config.RestartPolicy) {
+		return nil, fmt.Errorf("invalid restart policy '%s'", config.RestartPolicy)
+	}
+
 	currentVersion, err := semver.NewVersion(config.Version)
 
 	if err != nil {
 		return nil, fmt.Errorf("invalid current version '%s': %w", config.Version, err)
 	}
 
-	oras, err := oras.NewClient(config)
+	if config.DevMode {
+		return newDev(config, currentVersion)
+	}
+
+	src := config.Source
+
+	if src == nil {
+		registry, err := oras.NewSource(config)
+
+		if err != nil {
+			return nil, err
+		}
+
+		src = registry
+	}
+
+	basePath := filepath.Join(config.InstallationDir, config.BinaryName)
+	metrics := newMetrics()
+
+	if counter, ok := src.(source.TransferCounter); ok {
+		counter.CountTransfers(metrics.downloaded)
+	}
+
+	return &Supervisor{
+		source:         src,
+		config:         config,
+		currentVersion: currentVersion,
+		basePath:       basePath,
+		socketPath:     config.ResolveSocketPath(),
+		startedAt:      time.Now(),
+		logs:           newRing[LogEntry](logBufferSize),
+		metrics:        metrics,
+		output:         newOutput(basePath, config),
+		notify:         notifierFromEnv(),
+		restartFunc:    testhook.RestartFunc(config),
+	}, nil
+}
+
+// newDev creates a supervisor for dev mode. It installs into a scratch
+// directory, serves the fake dev source and never restarts the process.
+func newDev(config *config.Config, currentVersion *semver.Version) (*Supervisor, error) {
+	source, err := newDevSource(config, currentVersion)
+
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := prepareDevInstallation(config)
 
 	if err != nil {
 		return nil, err
 	}
 
+	socketPath := config.ResolveSocketPath()
+
+	// Keep the socket next to the scratch installation unless configured
+	if config.SocketPath == "" && config.RuntimeDir == "" && !config.AbstractSocket {
+		socketPath = filepath.Join(dir, config.BinaryName+".sock")
+	}
+
 	return &Supervisor{
-		oras:           *oras,
+		source:         source,
 		config:         config,
 		currentVersion: currentVersion,
-		basePath:       filepath.Join(config.InstallationDir, config.BinaryName),
-		socketPath:     fmt.Sprintf("/tmp/knockknock-%d.sock", os.Getpid()),
+		basePath:       filepath.Join(dir, config.BinaryName),
+		socketPath:     socketPath,
+		startedAt:      time.Now(),
+		logs:           newRing[LogEntry](logBufferSize),
+		metrics:        newMetrics(),
+		output:         newOutput(filepath.Join(dir, config.BinaryName), config),
+		notify:         notifierFromEnv(),
 	}, nil
 }
 
+func (s *Supervisor) Config() *config.Config {
+	return s.config
+}
+
+func (s *Supervisor) SocketPath() string {
+	return s.socketPath
+}
+
 func (s *Supervisor) CurrentVersion() *semver.Version {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	return s.currentVersion
 }
 
+func (s *Supervisor) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := Status{
+		Version:    *s.currentVersion,
+		PID:        os.Getpid(),
+		ChildPID:   s.childPID,
+		ChildReady: s.childReady,
+		StartedAt:  s.startedAt,
+		SocketPath: s.socketPath,
+		BasePath:   s.basePath,
+		CrashCount: s.crashCount,
+	}
+
+	if s.activeJob != nil {
+		job := *s.activeJob
+		status.ActiveJob = &job
+	}
+
+	if s.lastCrash != nil {
+		crash := *s.lastCrash
+		status.LastCrash = &crash
+	}
+
+	return status
+}
+
 func (s *Supervisor) CheckForUpdate(ctx context.Context) (update *semver.Version, allVersions []semver.Version, err error) {
-	allVersions, err = s.oras.Versions(ctx)
+	list, err := s.ListVersions(ctx)
 
 	if err != nil {
-		return
+		return nil, nil, err
 	}
 
-	if len(allVersions) == 0 {
-		err = fmt.Errorf("no versions found in repository")
-		return
-	}
+	return list.Update, list.Versions, nil
+}
 
-	latest := allVersions[len(allVersions)-1]
+// checkRequirements refuses versions the running version may not update to.
+func (s *Supervisor) checkRequirements(ctx context.Context, src source.UpdateSource, version string) error {
+	var metadata *source.Metadata
+	var err error
 
-	if latest.GreaterThan(s.currentVersion) {
-		// Update available
-		update = &latest
-		return
+	if src == s.source {
+		metadata, err = s.Metadata(ctx, version)
+	} else {
+		metadata, err = src.Metadata(ctx, version)
 	}
 
-	// No update available
-	return
+	if err != nil {
+		return fmt.Errorf("failed to fetch metadata for %s: %w", version, err)
+	}
+
+	return metadata.CheckSupervisorVersion(s.CurrentVersion())
+}
+
+// announceUpdate publishes update-available once per newly discovered version.
+func (s *Supervisor) announceUpdate(update *semver.Version) {
+	s.mu.Lock()
+	isNew := s.announced == nil || !s.announced.Equal(update)
+	s.announced = update
+	s.mu.Unlock()
+
+	if isNew {
+		s.publish(Event{Type: EventUpdateAvailable, Version: update.String()})
+	}
 }
 
 func (s *Supervisor) Update(ctx context.Context, version string) error {
+	return s.update(ctx, s.source, version, nil)
+}
+
+// update installs version from src and restarts into it. installed is
+// called once the version was activated, before the restart.
+func (s *Supervisor) update(ctx context.Context, src source.UpdateSource, version string, installed func()) error {
+	start := time.Now()
+
+	s.notify.Reloading(s.statusLine("updating to " + version))
+
+	if err := s.install(ctx, src, version); err != nil {
+		s.metrics.updateFailed()
+		s.notify.Reloaded(s.statusLine("update failed"))
+		return err
+	}
+
+	s.metrics.updateSucceeded(time.Since(start))
+
+	if installed != nil {
+		installed()
+	}
+
+	s.drain(config.RestartUpdate, version, fmt.Sprintf("restarting to apply update to %s", version))
+
+	return s.restart(version)
+}
+
+// install downloads, verifies and activates a version without restarting.
+func (s *Supervisor) install(ctx context.Context, src source.UpdateSource, version string) error {
+	if err := checkVersion(version); err != nil {
+		return err
+	}
+
+	if err := s.checkRequirements(ctx, src, version); err != nil {
+		return err
+	}
+
 	versionsDir := filepath.Join(s.basePath, "versions")
 
 	if err := os.MkdirAll(versionsDir, 0755); err != nil {
@@ -107,7 +314,29 @@ func (s *Supervisor) Update(ctx context.Context, version string) error {
 		return fmt.Errorf("failed to create version directory: %w", err)
 	}
 
-	if err := s.oras.DownloadUpdate(ctx, version, versionDir); err != nil {
+	// Sources counting their transfers report them to the metrics directly,
+	// since their progress includes cached and resumed bytes
+	_, counted := src.(source.TransferCounter)
+
+	var downloaded int64
+
+	progress := func(done, total int64) {
+		if !counted {
+			s.metrics.downloaded(done - downloaded)
+			downloaded = done
+		}
+
+		s.jobProgress(version, done, total)
+
+		s.publish(Event{
+			Type:       EventDownloadProgress,
+			Version:    version,
+			BytesDone:  done,
+			BytesTotal: total,
+		})
+	}
+
+	if err := src.Download(ctx, version, versionDir, progress); err != nil {
 		return fmt.Errorf("failed to download version %s: %w", version, err)
 	}
 
@@ -117,6 +346,8 @@ func (s *Supervisor) Update(ctx context.Context, version string) error {
 		return fmt.Errorf("binary verification failed: %w", err)
 	}
 
+	s.publish(Event{Type: EventUpdateReady, Version: version})
+
 	currentLink := filepath.Join(s.basePath, "current")
 
 	if _, err := os.Lstat(currentLink); err == nil {
@@ -151,13 +382,6 @@ func (s *Supervisor) Update(ctx context.Context, version string) error {
 		slog.Warn("failed to cleanup old backups", "error", err)
 	}
 
-	// Kill the current process - systemd will restart it with the new version
-	pid := os.Getpid()
-
-	if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
-		return fmt.Errorf("failed to send termination signal: %w", err)
-	}
-
 	return nil
 }
 
@@ -181,6 +405,40 @@ func (s *Supervisor) Rollback() error {
 		return fmt.Errorf("failed to read backup symlink: %w", err)
 	}
 
+	return s.rollbackTo(target, latestBackup)
+}
+
+// RollbackTo activates a specific version that is still installed on disk.
+func (s *Supervisor) RollbackTo(version string) error {
+	if err := checkVersion(version); err != nil {
+		return err
+	}
+
+	target := filepath.Join(s.basePath, "versions", version)
+
+	if _, err := os.Stat(target); err != nil {
+		return fmt.Errorf("version %s is not installed: %w", version, err)
+	}
+
+	backups, err := s.getBackupSymlinks()
+
+	if err != nil {
+		return fmt.Errorf("failed to find backup symlinks: %w", err)
+	}
+
+	// Consume the most recent backup pointing at the version, if any
+	backup := ""
+
+	for _, b := range backups {
+		if t, err := os.Readlink(b); err == nil && filepath.Clean(t) == target {
+			backup = b
+		}
+	}
+
+	return s.rollbackTo(target, backup)
+}
+
+func (s *Supervisor) rollbackTo(target, backup string) error {
 	binaryPath := filepath.Join(target, s.config.BinaryName)
 
 	if err := verifyBinary(binaryPath); err != nil {
@@ -194,20 +452,61 @@ func (s *Supervisor) Rollback() error {
 		return fmt.Errorf("failed to create temporary symlink: %w", err)
 	}
 
+	s.notify.Reloading(s.statusLine("rolling back to " + filepath.Base(target)))
+
 	// Atomically replace the symlink
 	if err := os.Rename(tempLink, currentLink); err != nil {
 		os.Remove(tempLink)
+		s.notify.Reloaded(s.statusLine("rollback failed"))
 		return fmt.Errorf("failed to swap symlink: %w", err)
 	}
 
-	if err := os.Remove(latestBackup); err != nil {
-		// Log but don't fail the rollback
-		slog.Warn("failed to remove backup symlink", "symlink", latestBackup, "error", err)
+	if backup != "" {
+		if err := os.Remove(backup); err != nil {
+			// Log but don't fail the rollback
+			slog.Warn("failed to remove backup symlink", "symlink", backup, "error", err)
+		}
+	}
+
+	version := filepath.Base(target)
+
+	s.publish(Event{Type: EventRollback, Version: version})
+	s.drain(config.RestartRollback, version, fmt.Sprintf("restarting to roll back to %s", version))
+
+	return s.restart(version)
+}
+
+// restart stops the process so the process manager starts it again with the
+// newly activated version.
+func (s *Supervisor) restart(version string) error {
+	if s.config.DevMode {
+		// The app runs in-process in dev mode, only pretend the version changed
+		v, err := semver.NewVersion(version)
+
+		if err != nil {
+			return fmt.Errorf("invalid version '%s': %w", version, err)
+		}
+
+		s.mu.Lock()
+		s.currentVersion = v
+		s.mu.Unlock()
+
+		slog.Info("dev mode: skipping restart", "version", version)
+		s.notify.Reloaded(s.statusLine("running"))
+
+		return nil
+	}
+
+	if s.restartFunc != nil {
+		defer s.notify.Reloaded(s.statusLine("running"))
+		return s.restartFunc(version)
 	}
 
+	s.notify.Stopping(s.statusLine("restarting to " + version))
+
 	pid := os.Getpid()
 
-	// Kill the current process - systemd will restart it with the rolled-back version
+	// Kill the current process - systemd will restart it with the new version
 	if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
 		return fmt.Errorf("failed to send termination signal: %w", err)
 	}
@@ -344,3 +643,14 @@ func verifyBinary(path string) error {
 
 	return nil
 }
+
+// checkVersion returns ErrInvalidVersion unless version is a semver
+// version, which also keeps it from escaping the versions directory when it
+// is used as a path.
+func checkVersion(version string) error {
+	if _, err := semver.NewVersion(version); err != nil {
+		return fmt.Errorf("%w '%s': %w", ErrInvalidVersion, version, err)
+	}
+
+	return nil
+}
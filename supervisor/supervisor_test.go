@@ -0,0 +1,172 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/zeitlos/knockknock/config"
+	"github.com/zeitlos/knockknock/source"
+)
+
+func TestRollbackToRejectsInvalidVersions(t *testing.T) {
+	dir := t.TempDir()
+
+	// A directory a traversing version would point at
+	if err := os.MkdirAll(filepath.Join(dir, "x"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Supervisor{
+		config:         config.New("app"),
+		currentVersion: semver.MustParse("1.0.0"),
+		basePath:       filepath.Join(dir, "app"),
+	}
+
+	for _, version := range []string{"../../x", "../x", "1.0.0/../../x", ""} {
+		if err := s.RollbackTo(version); !errors.Is(err, ErrInvalidVersion) {
+			t.Errorf("RollbackTo(%q) = %v, expected ErrInvalidVersion", version, err)
+		}
+
+		if _, err := s.StartUpdate(version); !errors.Is(err, ErrInvalidVersion) {
+			t.Errorf("StartUpdate(%q) = %v, expected ErrInvalidVersion", version, err)
+		}
+	}
+}
+
+type staticSource struct {
+	source.UpdateSource
+
+	mu       sync.Mutex
+	versions []semver.Version
+}
+
+func (s *staticSource) Versions(ctx context.Context) ([]semver.Version, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.versions, nil
+}
+
+func (s *staticSource) add(version string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.versions = append(s.versions, *semver.MustParse(version))
+}
+
+func newCheckingSupervisor(t *testing.T, cfg *config.Config) (*Supervisor, *staticSource) {
+	t.Helper()
+
+	src := &staticSource{versions: []semver.Version{*semver.MustParse("1.0.0")}}
+
+	return &Supervisor{
+		source:         src,
+		config:         cfg,
+		currentVersion: semver.MustParse("1.0.0"),
+		basePath:       t.TempDir(),
+	}, src
+}
+
+// expectAnnounced reads the update-available events published so far.
+func expectAnnounced(t *testing.T, events <-chan Event, versions ...string) {
+	t.Helper()
+
+	for _, version := range versions {
+		select {
+		case event := <-events:
+			if event.Type != EventUpdateAvailable || event.Version != version {
+				t.Fatalf("expected update-available for %s, got %+v", version, event)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected update-available for %s", version)
+		}
+	}
+
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected event %+v", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestUpdateAvailableOncePerVersion(t *testing.T) {
+	s, src := newCheckingSupervisor(t, config.New("app").WithVersionCacheTTL(time.Hour))
+
+	events, unsubscribe := s.Subscribe()
+	defer unsubscribe()
+
+	src.add("1.1.0")
+
+	if _, _, err := s.CheckForUpdate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	expectAnnounced(t, events, "1.1.0")
+
+	// Served from the cache
+	if _, err := s.ListVersions(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	expectAnnounced(t, events)
+
+	// Checking the source again finds nothing new
+	s.versionCache.FetchedAt = time.Time{}
+
+	if _, _, err := s.CheckForUpdate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	expectAnnounced(t, events)
+
+	src.add("1.2.0")
+	s.versionCache.FetchedAt = time.Time{}
+
+	if _, _, err := s.CheckForUpdate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	expectAnnounced(t, events, "1.2.0")
+}
+
+func TestBackgroundUpdateCheck(t *testing.T) {
+	cfg := config.New("app").
+		WithVersionCacheTTL(0).
+		WithUpdateCheckInterval(20 * time.Millisecond)
+
+	s, src := newCheckingSupervisor(t, cfg)
+
+	events, unsubscribe := s.Subscribe()
+	defer unsubscribe()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		s.checkUpdates(ctx)
+		close(done)
+	}()
+
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// Nothing newer yet
+	expectAnnounced(t, events)
+
+	// No client asks, the background check finds it, once
+	src.add("1.1.0")
+
+	expectAnnounced(t, events, "1.1.0")
+
+	time.Sleep(100 * time.Millisecond)
+
+	expectAnnounced(t, events)
+}
@@ -0,0 +1,241 @@
+package supervisor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/zeitlos/knockknock/source"
+)
+
+// VersionList is the result of listing the update source.
+type VersionList struct {
+	Versions []semver.Version
+	// Update is the newest version if it is newer than the current one.
+	Update    *semver.Version
+	FetchedAt time.Time
+	// Stale is set when the source could not be reached and the last
+	// successful listing is returned instead.
+	Stale bool
+}
+
+// versionCache is the last successful listing, persisted in
+// <base path>/cache/versions.json so it survives restarts.
+type versionCache struct {
+	// Source identifies the update source the listing came from.
+	Source    string    `json:"source"`
+	Versions  []string  `json:"versions"`
+	ETag      string    `json:"etag,omitempty"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// ListVersions returns the versions offered by the update source. Listings
+// are cached for config.VersionCacheTTL, and the last one is served as
+// stale while the source is unreachable.
+func (s *Supervisor) ListVersions(ctx context.Context) (VersionList, error) {
+	s.versionsMu.Lock()
+	defer s.versionsMu.Unlock()
+
+	if s.versionCache == nil {
+		s.versionCache = s.loadVersionCache()
+	}
+
+	cache := s.versionCache
+
+	if cache != nil && time.Since(cache.FetchedAt) < s.config.VersionCacheTTL {
+		return s.announce(s.versionList(cache, false))
+	}
+
+	fresh, err := s.fetchVersions(ctx, cache)
+
+	switch {
+	case errors.Is(err, source.ErrNotModified) && cache != nil:
+		cache.FetchedAt = time.Now()
+	case err != nil:
+		if cache == nil || ctx.Err() != nil {
+			return VersionList{}, err
+		}
+
+		slog.Warn("update source unreachable, serving cached versions", "fetchedAt", cache.FetchedAt, "error", err)
+
+		return s.announce(s.versionList(cache, true))
+	default:
+		cache = fresh
+	}
+
+	s.versionCache = cache
+	s.saveVersionCache(cache)
+
+	return s.announce(s.versionList(cache, false))
+}
+
+// announce publishes the update of a listing, unless it was announced
+// already.
+func (s *Supervisor) announce(list VersionList, err error) (VersionList, error) {
+	if err == nil && list.Update != nil {
+		s.announceUpdate(list.Update)
+	}
+
+	return list, err
+}
+
+// checkUpdates lists the update source every config.UpdateCheckInterval, so
+// subscribers learn about new versions without polling.
+func (s *Supervisor) checkUpdates(ctx context.Context) {
+	interval := s.config.UpdateCheckInterval
+
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		checkCtx, cancel := context.WithTimeout(ctx, interval)
+		_, err := s.ListVersions(checkCtx)
+		cancel()
+
+		if err != nil && ctx.Err() == nil {
+			slog.Warn("background update check failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// fetchVersions lists the source, conditionally on the cached listing if
+// the source supports it.
+func (s *Supervisor) fetchVersions(ctx context.Context, cache *versionCache) (*versionCache, error) {
+	fresh := &versionCache{
+		Source:    s.sourceID(),
+		FetchedAt: time.Now(),
+	}
+
+	var versions []semver.Version
+	var err error
+
+	if conditional, ok := s.source.(source.ConditionalSource); ok {
+		etag := ""
+
+		if cache != nil {
+			etag = cache.ETag
+		}
+
+		versions, fresh.ETag, err = conditional.VersionsIfChanged(ctx, etag)
+	} else {
+		versions, err = s.source.Versions(ctx)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range versions {
+		fresh.Versions = append(fresh.Versions, v.Original())
+	}
+
+	return fresh, nil
+}
+
+func (s *Supervisor) versionList(cache *versionCache, stale bool) (VersionList, error) {
+	list := VersionList{
+		FetchedAt: cache.FetchedAt,
+		Stale:     stale,
+	}
+
+	for _, v := range cache.Versions {
+		version, err := semver.NewVersion(v)
+
+		if err != nil {
+			continue
+		}
+
+		list.Versions = append(list.Versions, *version)
+	}
+
+	if len(list.Versions) == 0 {
+		return list, fmt.Errorf("no versions found in repository")
+	}
+
+	latest := list.Versions[len(list.Versions)-1]
+
+	if latest.GreaterThan(s.CurrentVersion()) {
+		list.Update = &latest
+	}
+
+	return list, nil
+}
+
+// sourceID identifies the configured update source, so a cached listing is
+// not served after the source was changed.
+func (s *Supervisor) sourceID() string {
+	if s.config.Source == nil {
+		return s.config.Repo
+	}
+
+	return fmt.Sprintf("%T", s.config.Source)
+}
+
+func (s *Supervisor) versionCachePath() string {
+	return filepath.Join(s.basePath, "cache", "versions.json")
+}
+
+func (s *Supervisor) loadVersionCache() *versionCache {
+	data, err := os.ReadFile(s.versionCachePath())
+
+	if err != nil {
+		return nil
+	}
+
+	var cache versionCache
+
+	if err := json.Unmarshal(data, &cache); err != nil {
+		slog.Warn("ignoring invalid version cache", "error", err)
+		return nil
+	}
+
+	if cache.Source != s.sourceID() {
+		return nil
+	}
+
+	return &cache
+}
+
+func (s *Supervisor) saveVersionCache(cache *versionCache) {
+	path := s.versionCachePath()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		slog.Warn("failed to create cache directory", "error", err)
+		return
+	}
+
+	data, err := json.MarshalIndent(cache, "", "  ")
+
+	if err != nil {
+		slog.Warn("failed to encode version cache", "error", err)
+		return
+	}
+
+	// Write a temporary file first, so a crash never leaves a torn cache
+	tmp := path + ".tmp"
+
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		slog.Warn("failed to write version cache", "error", err)
+		return
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		slog.Warn("failed to write version cache", "error", err)
+	}
+}
@@ -0,0 +1,98 @@
+package supervisor
+
+import (
+	"log/slog"
+	"syscall"
+	"time"
+)
+
+// watchdogGrace is how long the child has to write its goroutine dump after
+// SIGQUIT before it is killed.
+const watchdogGrace = 5 * time.Second
+
+// Heartbeat records that the child is alive. It reports whether a started
+// child was running to receive it.
+func (s *Supervisor) Heartbeat() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.childPID == 0 || !s.childReady {
+		return false
+	}
+
+	s.lastHeartbeat = time.Now()
+
+	return true
+}
+
+// childHealthy reports whether the child is starting or, with the watchdog
+// enabled, sent its last heartbeat within the watchdog timeout.
+func (s *Supervisor) childHealthy() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.config.WatchdogTimeout == 0 || !s.childReady {
+		return true
+	}
+
+	return time.Since(s.lastHeartbeat) <= s.config.WatchdogTimeout
+}
+
+// HeartbeatInterval is how often the child should send heartbeats, or zero
+// if the watchdog is disabled.
+func (s *Supervisor) HeartbeatInterval() time.Duration {
+	return s.config.WatchdogTimeout / 3
+}
+
+// watchHeartbeats kills the child once it said hello and then stopped
+// sending heartbeats for longer than the watchdog timeout. The child is sent
+// SIGQUIT first, so that a Go child dumps its goroutines into the crash
+// report.
+func (s *Supervisor) watchHeartbeats(pid int, hello <-chan struct{}, exited <-chan struct{}) {
+	select {
+	case <-hello:
+	case <-exited:
+		return
+	}
+
+	timeout := s.config.WatchdogTimeout
+
+	ticker := time.NewTicker(timeout / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-exited:
+			return
+		case <-ticker.C:
+		}
+
+		s.mu.Lock()
+		silent := time.Since(s.lastHeartbeat)
+		s.mu.Unlock()
+
+		if silent > timeout {
+			break
+		}
+	}
+
+	s.mu.Lock()
+	s.watchdogFired = true
+	s.mu.Unlock()
+
+	slog.Error("child stopped sending heartbeats, killing it", "pid", pid, "timeout", timeout)
+
+	if err := syscall.Kill(pid, syscall.SIGQUIT); err != nil {
+		slog.Error("failed to send SIGQUIT to child", "pid", pid, "error", err)
+	}
+
+	select {
+	case <-exited:
+		return
+	case <-time.After(watchdogGrace):
+	}
+
+	if err := syscall.Kill(pid, syscall.SIGKILL); err != nil {
+		slog.Error("failed to kill child", "pid", pid, "error", err)
+	}
+}